@@ -0,0 +1,504 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// applyChange is what `scalr apply` does to one resource of the manifest.
+type applyChange struct {
+	Resource      manifestResource
+	Kind          manifestKind
+	ID            string                       // existing resource, empty when it is created
+	Attributes    map[string]any               // all attributes when created, the changed ones when updated
+	Relationships map[string]applyRelationship // relationships to send, likewise
+	Scope         map[string]applyRelationship // relationships the resource was looked up within
+	Diff          []string                     // what changes, for the plan
+}
+
+// applyRelationship is a relationship of a manifest resource with its names resolved to IDs.
+type applyRelationship struct {
+	Type  string
+	IDs   []string
+	Array bool
+}
+
+func (c applyChange) unchanged() bool {
+	return c.ID != "" && len(c.Diff) == 0
+}
+
+// pendingRef stands in for the ID of a resource that is created earlier in the same apply.
+func pendingRef(kind string, name string) string {
+	return "<" + kind + " '" + name + "'>"
+}
+
+func isPendingRef(id string) bool {
+	return strings.HasPrefix(id, "<")
+}
+
+// runApply creates or updates the resources of a manifest so they match it. Resources that
+// exist with other values are patched with the changed attributes only, resources missing
+// from the manifest are left alone. With -check it only reports whether anything differs.
+func runApply(index *CommandIndex, args []string, dryRun bool) {
+	applyFlags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	applyFlags.Usage = func() {}
+	file := applyFlags.String("f", "", "")
+	check := applyFlags.Bool("check", false, "")
+	parseFlags(applyFlags, args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Usage: scalr apply -f <file> [-check]")
+		fmt.Fprintln(os.Stderr, "  scalr apply -f resources.yaml           Create or update the resources in the file")
+		fmt.Fprintln(os.Stderr, "  scalr -dry-run apply -f resources.yaml  Only show what would change")
+		fmt.Fprintln(os.Stderr, "  scalr apply -f resources.yaml -check    Exit with code 4 if anything differs from the file")
+		os.Exit(ExitError)
+	}
+
+	resources, err := readManifest(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(ExitError)
+	}
+
+	//Resources that belong to the account are created in it, so it must be known up front
+	for _, r := range resources {
+		if ScalrAccount == "" && manifestKinds[r.Kind].AccountScoped && !r.scoped() {
+			fmt.Fprintf(os.Stderr, "Error: %s belongs to an account, but none is set. Set SCALR_ACCOUNT or the account of your profile.\n", r)
+			os.Exit(ExitError)
+		}
+	}
+
+	changes := planApply(index, resources)
+
+	drift := printApplyPlan(os.Stdout, changes)
+
+	if *check {
+		if drift {
+			os.Exit(ExitDrift)
+		}
+		return
+	}
+
+	if dryRun || !drift {
+		return
+	}
+
+	executeApply(changes)
+}
+
+// planApply looks up every resource of the manifest and works out what has to change.
+// Relationships to resources listed earlier in the manifest use the ID found for them,
+// or a pendingRef if they are yet to be created.
+func planApply(index *CommandIndex, resources []manifestResource) []applyChange {
+	known := make(map[string]string)
+	var changes []applyChange
+
+	for _, r := range resources {
+		kind := manifestKinds[r.Kind]
+
+		relationships := make(map[string]applyRelationship)
+		for _, name := range sortedKeys(r.Relationships) {
+			relationships[name] = resolveRelationship(index, r, name, known)
+		}
+
+		change := applyChange{Resource: r, Kind: kind, Scope: make(map[string]applyRelationship)}
+
+		for _, scope := range kind.Scopes {
+			if rel, ok := relationships[scope]; ok {
+				change.Scope[scope] = rel
+				delete(relationships, scope)
+			}
+		}
+
+		existing := findExisting(r, kind, change.Scope)
+
+		if existing == nil {
+			change.Attributes = r.Attributes
+			change.Relationships = relationships
+
+			for _, key := range sortedKeys(r.Attributes) {
+				change.Diff = append(change.Diff, fmt.Sprintf("%s: %s", key, displayJSON(r.Attributes[key])))
+			}
+			for _, name := range sortedKeys(r.Relationships) {
+				rel, ok := relationships[name]
+				if !ok {
+					rel = change.Scope[name]
+				}
+				change.Diff = append(change.Diff, fmt.Sprintf("%s: %s", name, strings.Join(rel.IDs, ", ")))
+			}
+
+			rememberRef(known, r, pendingRef(r.Kind, r.qualifiedName()))
+		} else {
+			change.ID, _ = existing.Path("id").Data().(string)
+			rememberRef(known, r, change.ID)
+			change.Attributes, change.Relationships, change.Diff = diffResource(existing, r.Attributes, relationships)
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// rememberRef records the ID of a manifest resource for the relationships of the resources
+// after it. Names used in more than one scope, like workspaces, are left to the lookup unless
+// they are qualified with their scope, like production/network.
+func rememberRef(known map[string]string, r manifestResource, id string) {
+	kind := manifestKinds[r.Kind]
+	if kind.Key == "" {
+		return
+	}
+
+	ref := pendingRef(r.Kind, r.identity())
+	if previous, ok := known[ref]; ok && previous != id {
+		known[ref] = ""
+	} else {
+		known[ref] = id
+	}
+
+	if qualified := r.qualifiedName(); qualified != r.identity() {
+		known[pendingRef(r.Kind, qualified)] = id
+	}
+}
+
+// resolveRelationship turns the names in a relationship of a manifest resource into IDs.
+func resolveRelationship(index *CommandIndex, r manifestResource, name string, known map[string]string) applyRelationship {
+	rel := applyRelationship{Type: manifestKinds[r.Kind].relationshipType(index, name)}
+	if rel.Type == "" {
+		fmt.Fprintf(os.Stderr, "Error: %s: the API specification has no relationship %s for %s resources\n", r, name, r.Kind)
+		os.Exit(ExitError)
+	}
+	kind := strings.TrimSuffix(rel.Type, "s")
+
+	var values []string
+
+	switch value := r.Relationships[name].(type) {
+	case string:
+		values = []string{value}
+	case []any:
+		rel.Array = true
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Error: %s: relationship %s must be a list of names or IDs\n", r, name)
+				os.Exit(ExitError)
+			}
+			values = append(values, text)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %s: relationship %s must be a name, an ID or a list of them\n", r, name)
+		os.Exit(ExitError)
+	}
+
+	for _, value := range values {
+		if id := known[pendingRef(kind, value)]; id != "" {
+			rel.IDs = append(rel.IDs, id)
+		} else {
+			rel.IDs = append(rel.IDs, resolveTypedName(rel.Type, value))
+		}
+	}
+
+	return rel
+}
+
+// findExisting looks up a manifest resource by its name or key within its scope, with the
+// same name-filtered lookup as resolveNameToID. The filter is not exact on every endpoint,
+// so the matches are checked once more. Returns nil if the resource does not exist yet.
+func findExisting(r manifestResource, kind manifestKind, scope map[string]applyRelationship) *gabs.Container {
+	params := url.Values{}
+	if kind.Key != "" {
+		params.Set("filter["+kind.Key+"]", r.identity())
+	}
+
+	for name, rel := range scope {
+		//Nothing can exist yet in a scope that is only created by this apply
+		if isPendingRef(rel.IDs[0]) {
+			return nil
+		}
+		if !kind.inPath(name) {
+			params.Set("filter["+name+"]", rel.IDs[0])
+		}
+	}
+
+	endpoint, _ := kind.endpoint(scopeIDs(scope, nil))
+
+	items, ok := lookupResources(endpoint, params)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Could not look up %s\n", r)
+		os.Exit(ExitError)
+	}
+
+	var matches []*gabs.Container
+
+	for _, item := range items {
+		if value, _ := item.Search("attributes", kind.Key).Data().(string); kind.Key != "" && value != r.identity() {
+			continue
+		}
+
+		//Scopes go from the outermost to the innermost; a scope that is not given must be
+		//empty, unless a more specific one is given (a workspace variable in any environment)
+		inScope := true
+		for i, name := range kind.Scopes {
+			if kind.inPath(name) {
+				continue
+			}
+
+			want := ""
+			if rel, ok := scope[name]; ok {
+				want = rel.IDs[0]
+			} else if innerScopeGiven(kind.Scopes[i+1:], scope) {
+				continue
+			}
+			if got, _ := item.Search("relationships", name, "data", "id").Data().(string); got != want {
+				inScope = false
+			}
+		}
+
+		if inScope {
+			matches = append(matches, item)
+		}
+	}
+
+	if len(matches) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: Multiple resources match %s:\n", r)
+		for _, item := range matches {
+			fmt.Fprintf(os.Stderr, "  %s\n", item.Path("id").Data())
+		}
+		os.Exit(ExitError)
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	return matches[0]
+}
+
+// scopeIDs returns the ID of every scope, with the IDs of resources created earlier
+// in the run in place of their pendingRef.
+func scopeIDs(scope map[string]applyRelationship, created map[string]string) map[string]string {
+	ids := make(map[string]string)
+
+	for name, rel := range scope {
+		ids[name] = rel.IDs[0]
+		if resolved, ok := created[rel.IDs[0]]; ok {
+			ids[name] = resolved
+		}
+	}
+
+	return ids
+}
+
+func innerScopeGiven(scopes []string, given map[string]applyRelationship) bool {
+	for _, name := range scopes {
+		if _, ok := given[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diffResource compares an existing resource with the attributes and relationships of the
+// manifest, and returns the ones that differ along with a line per difference.
+func diffResource(existing *gabs.Container, attributes map[string]any, relationships map[string]applyRelationship) (map[string]any, map[string]applyRelationship, []string) {
+	changedAttributes := make(map[string]any)
+	changedRelationships := make(map[string]applyRelationship)
+	var diff []string
+
+	for _, key := range sortedKeys(attributes) {
+		want := normalizeJSON(attributes[key])
+		got := normalizeJSON(existing.Search("attributes", key).Data())
+
+		//The API never returns the value of a sensitive variable, so it cannot be compared
+		if key == "value" && got == nil && existing.Search("attributes", "sensitive").Data() == true {
+			continue
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			changedAttributes[key] = attributes[key]
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s", key, displayJSON(got), displayJSON(want)))
+		}
+	}
+
+	for _, name := range sortedKeys(relationships) {
+		rel := relationships[name]
+
+		var current []string
+		data := existing.Search("relationships", name, "data")
+		if rel.Array {
+			for _, item := range data.Children() {
+				id, _ := item.Path("id").Data().(string)
+				current = append(current, id)
+			}
+		} else if id, ok := data.Path("id").Data().(string); ok {
+			current = []string{id}
+		}
+
+		want := append([]string(nil), rel.IDs...)
+		sort.Strings(current)
+		sort.Strings(want)
+
+		if !reflect.DeepEqual(current, want) {
+			changedRelationships[name] = rel
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s", name, strings.Join(current, ", "), strings.Join(rel.IDs, ", ")))
+		}
+	}
+
+	return changedAttributes, changedRelationships, diff
+}
+
+// normalizeJSON brings a value to the form it has when decoded from JSON, so values read
+// from YAML compare equal to the ones returned by the API.
+func normalizeJSON(value any) any {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var normalized any
+	json.Unmarshal(content, &normalized)
+
+	return normalized
+}
+
+// displayJSON shows a value the way it is sent to the API.
+func displayJSON(value any) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(content)
+}
+
+// printApplyPlan prints what apply does to each resource, followed by a summary.
+// Returns whether anything has to change.
+func printApplyPlan(w io.Writer, changes []applyChange) bool {
+	created, updated, unchanged := 0, 0, 0
+
+	for _, c := range changes {
+		switch {
+		case c.ID == "":
+			created++
+			fmt.Fprintf(w, "+ create %s\n", c.Resource)
+		case c.unchanged():
+			unchanged++
+			continue
+		default:
+			updated++
+			fmt.Fprintf(w, "~ update %s (%s)\n", c.Resource, c.ID)
+		}
+
+		for _, line := range c.Diff {
+			fmt.Fprintf(w, "      %s\n", line)
+		}
+	}
+
+	if created+updated == 0 {
+		fmt.Fprintf(w, "No changes. %d resource(s) up to date.\n", unchanged)
+		return false
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d unchanged.\n", created, updated, unchanged)
+
+	return true
+}
+
+// executeApply sends the planned changes in the order of the manifest, so resources can
+// refer to the ones listed before them.
+func executeApply(changes []applyChange) {
+	created := make(map[string]string)
+
+	for _, c := range changes {
+		if c.unchanged() {
+			continue
+		}
+
+		body := applyRequestBody(c, created)
+
+		endpoint, _ := c.Kind.endpoint(scopeIDs(c.Scope, created))
+
+		if c.ID == "" {
+			response := sendJSON("POST", endpoint, nil, body.Bytes())
+			id, _ := response.Path("data.id").Data().(string)
+			created[pendingRef(c.Resource.Kind, c.Resource.qualifiedName())] = id
+
+			fmt.Fprintf(os.Stderr, "Created %s (%s)\n", c.Resource, id)
+		} else {
+			if c.Kind.Self != "" {
+				endpoint = c.Kind.Self
+			}
+
+			sendJSON("PATCH", endpoint+"/"+c.ID, nil, body.Bytes())
+
+			fmt.Fprintf(os.Stderr, "Updated %s (%s)\n", c.Resource, c.ID)
+		}
+	}
+}
+
+// applyRequestBody builds the JSON:API body that creates or updates a resource. IDs of
+// resources created earlier in the run replace their pendingRef.
+func applyRequestBody(c applyChange, created map[string]string) *gabs.Container {
+	body := gabs.New()
+	body.Set(c.Kind.Type, "data", "type")
+
+	attributes := make(map[string]any)
+	for key, value := range c.Attributes {
+		attributes[key] = value
+	}
+
+	relationships := make(map[string]applyRelationship)
+	for name, rel := range c.Relationships {
+		relationships[name] = rel
+	}
+
+	if c.ID != "" {
+		body.Set(c.ID, "data", "id")
+	} else {
+		if c.Kind.Key != "" {
+			attributes[c.Kind.Key] = c.Resource.identity()
+		}
+
+		for name, rel := range c.Scope {
+			if !c.Kind.inPath(name) {
+				relationships[name] = rel
+			}
+		}
+
+		if c.Kind.AccountScoped && len(c.Scope) == 0 {
+			relationships["account"] = applyRelationship{Type: "accounts", IDs: []string{ScalrAccount}}
+		}
+	}
+
+	if len(attributes) > 0 {
+		body.Set(attributes, "data", "attributes")
+	}
+
+	for name, rel := range relationships {
+		var data []any
+		for _, id := range rel.IDs {
+			if resolved, ok := created[id]; ok {
+				id = resolved
+			}
+			data = append(data, map[string]any{"type": rel.Type, "id": id})
+		}
+
+		if rel.Array {
+			body.Set(data, "data", "relationships", name, "data")
+		} else {
+			body.Set(data[0], "data", "relationships", name, "data")
+		}
+	}
+
+	return body
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadManifest(t *testing.T) {
+	resources, err := readManifest(writeManifest(t, `
+resources:
+  - kind: environment
+    name: production
+  - kind: workspace
+    name: network
+    attributes:
+      auto-apply: true
+      max-count: 3
+    relationships:
+      environment: production
+      tags: [prod, core]
+  - kind: variable
+    key: region
+    attributes: {value: us-east-1, category: terraform}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 3 {
+		t.Fatalf("expected 3 resources, got %d", len(resources))
+	}
+	if resources[1].identity() != "network" || resources[2].identity() != "region" {
+		t.Errorf("unexpected identities: %q, %q", resources[1].identity(), resources[2].identity())
+	}
+	if resources[1].Attributes["max-count"] != 3 {
+		t.Errorf("expected max-count 3, got %#v", resources[1].Attributes["max-count"])
+	}
+
+	invalid := map[string]string{
+		"unknown kind":       "resources:\n  - kind: planet\n    name: earth\n",
+		"missing name":       "resources:\n  - kind: tag\n",
+		"missing key":        "resources:\n  - kind: variable\n    name: region\n",
+		"missing scope":      "resources:\n  - kind: workspace\n    name: network\n",
+		"run trigger scope":  "resources:\n  - kind: run-trigger\n    relationships: {downstream: app}\n",
+		"duplicate resource": "resources:\n  - kind: tag\n    name: prod\n  - kind: tag\n    name: prod\n",
+	}
+	for name, content := range invalid {
+		if _, err := readManifest(writeManifest(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDiffResource(t *testing.T) {
+	existing := parseJSONForTest(t, `{
+		"id": "ws-1",
+		"attributes": {"name": "network", "auto-apply": false, "max-count": 3, "value": null, "sensitive": true},
+		"relationships": {"tags": {"data": [{"type": "tags", "id": "tag-2"}, {"type": "tags", "id": "tag-1"}]}}
+	}`)
+
+	attributes := map[string]any{"auto-apply": true, "max-count": 3, "value": "secret"}
+	relationships := map[string]applyRelationship{
+		"tags": {Type: "tags", IDs: []string{"tag-1", "tag-2"}, Array: true},
+	}
+
+	changed, changedRelationships, diff := diffResource(existing, attributes, relationships)
+
+	if len(changed) != 1 || changed["auto-apply"] != true {
+		t.Errorf("expected only auto-apply to change, got %v", changed)
+	}
+	if len(changedRelationships) != 0 {
+		t.Errorf("tags in another order must not change, got %v", changedRelationships)
+	}
+	if len(diff) != 1 || diff[0] != "auto-apply: false -> true" {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	var sent []string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/environments":
+			fmt.Fprint(w, `{"data": [
+				{"id": "env-1", "type": "environments", "attributes": {"name": "production"}},
+				{"id": "env-2", "type": "environments", "attributes": {"name": "production-old"}}
+			]}`)
+		case r.Method == "GET" && r.URL.Path == "/workspaces" && r.URL.Query().Get("filter[name]") == "network":
+			if r.URL.Query().Get("filter[environment]") != "env-1" {
+				t.Errorf("workspace lookup not scoped to the environment: %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"data": [{"id": "ws-1", "type": "workspaces",
+				"attributes": {"name": "network", "auto-apply": false},
+				"relationships": {"environment": {"data": {"type": "environments", "id": "env-1"}}}}]}`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"data": []}`)
+		case r.Method == "POST" && r.URL.Path == "/environments":
+			body := new(bytes.Buffer)
+			body.ReadFrom(r.Body)
+			sent = append(sent, "POST "+r.URL.Path+" "+body.String())
+			fmt.Fprint(w, `{"data": {"id": "env-new", "type": "environments"}}`)
+		default:
+			body := new(bytes.Buffer)
+			body.ReadFrom(r.Body)
+			sent = append(sent, r.Method+" "+r.URL.Path+" "+body.String())
+			fmt.Fprint(w, `{"data": {"id": "ws-new", "type": "workspaces"}}`)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	resources, err := readManifest(writeManifest(t, `
+resources:
+  - kind: environment
+    name: production
+  - kind: environment
+    name: staging
+  - kind: workspace
+    name: network
+    attributes: {auto-apply: true}
+    relationships: {environment: production}
+  - kind: workspace
+    name: network
+    relationships: {environment: staging}
+  - kind: variable
+    key: region
+    relationships: {workspace: staging/network}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []applyChange
+	captureStderr(t, func() { changes = planApply(testIndex(t), resources) })
+
+	var plan bytes.Buffer
+	if !printApplyPlan(&plan, changes) {
+		t.Fatal("expected changes")
+	}
+
+	for _, want := range []string{
+		"+ create environment 'staging'",
+		"~ update workspace 'network' (ws-1)\n      auto-apply: false -> true",
+		"+ create workspace 'network'\n      environment: <environment 'staging'>",
+		"+ create variable 'region'\n      workspace: <workspace 'staging/network'>",
+		"Plan: 3 to create, 1 to update, 1 unchanged.",
+	} {
+		if !strings.Contains(plan.String(), want) {
+			t.Errorf("plan is missing %q:\n%s", want, plan.String())
+		}
+	}
+
+	captureStderr(t, func() { executeApply(changes) })
+
+	want := []string{
+		`POST /environments {"data":{"attributes":{"name":"staging"},"relationships":{"account":{"data":{"id":"acc-test","type":"accounts"}}},"type":"environments"}}`,
+		`PATCH /workspaces/ws-1 {"data":{"attributes":{"auto-apply":true},"id":"ws-1","type":"workspaces"}}`,
+		`POST /workspaces {"data":{"attributes":{"name":"network"},"relationships":{"environment":{"data":{"id":"env-new","type":"environments"}}},"type":"workspaces"}}`,
+		`POST /vars {"data":{"attributes":{"key":"region"},"relationships":{"workspace":{"data":{"id":"ws-new","type":"workspaces"}}},"type":"vars"}}`,
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("expected %d requests, got %v", len(want), sent)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("request %d:\n got %s\nwant %s", i, sent[i], want[i])
+		}
+	}
+}
+
+func TestRelationshipType(t *testing.T) {
+	index := testIndex(t)
+
+	tests := []struct {
+		kind string
+		name string
+		want string
+	}{
+		{"workspace", "environment", "environments"},
+		{"workspace", "tags", "tags"},
+		{"variable", "workspace", "workspaces"},
+		{"run-trigger", "upstream", "workspaces"},
+		{"workspace", "vcs-provider", ""},
+	}
+
+	for _, tt := range tests {
+		if got := manifestKinds[tt.kind].relationshipType(index, tt.name); got != tt.want {
+			t.Errorf("%s %s: expected %q, got %q", tt.kind, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestManifestResourceScoped(t *testing.T) {
+	accountVar := manifestResource{Kind: "variable", Key: "region"}
+	workspaceVar := manifestResource{Kind: "variable", Key: "region", Relationships: map[string]any{"workspace": "production/network"}}
+
+	if accountVar.scoped() {
+		t.Error("a variable without a workspace or environment belongs to the account")
+	}
+	if !workspaceVar.scoped() {
+		t.Error("a variable of a workspace does not belong to the account")
+	}
+}
@@ -9,8 +9,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"github.com/getkin/kin-openapi/openapi3"
 )
 
 func runAutocomplete() {
@@ -70,7 +68,7 @@ func listComplete(items []string, prefix string) {
 func autoBasic(flags []string) {
 
 	if flags[0] != "" && flags[0][:1] == "-" && len(flags) == 1 {
-		listComplete([]string{"-version ", "-help ", "-verbose ", "-configure ", "-update ", "-autocomplete ", "-format=", "-fields=", "-page=", "-page-size=", "-profile=", "-query=", "-quiet "}, flags[0])
+		listComplete([]string{"-version ", "-help ", "-verbose ", "-configure ", "-update ", "-autocomplete ", "-format=", "-fields=", "-resolve-names ", "-page=", "-page-size=", "-profile=", "-query=", "-quiet ", "-spec=", "-dry-run ", "-yes ", "-force "}, flags[0])
 	}
 }
 
@@ -92,6 +90,11 @@ func autoCommands(allFlags map[string]map[string][]string, flags []string, prefi
 		// Add built-in commands
 		commands = append(commands, "wait-for-run ")
 		commands = append(commands, "open ")
+		commands = append(commands, "config ")
+		commands = append(commands, "spec ")
+		commands = append(commands, "apply ")
+		commands = append(commands, "export ")
+		commands = append(commands, "cache ")
 
 		listComplete(commands, prefix)
 	}
@@ -136,161 +139,40 @@ func autoOptions(allFlags map[string]map[string][]string, command string, prefix
 	}
 }
 
-// Load all available flags and options from OpenAPI
+// Load all available flags and options from the precompiled command index
 func collectFlagsAndOptions() map[string]map[string][]string {
 
 	allFlags := make(map[string]map[string][]string)
 
-	doc := loadAPI()
-
-	for _, path := range doc.Paths.Map() {
-		for _, object := range path.Operations() {
-
-			command := strings.ReplaceAll(object.OperationID, "_", "-")
+	index := loadIndex()
 
-			allFlags[command] = make(map[string][]string)
+	for command, cmd := range index.Commands {
 
-			for _, parameter := range object.Parameters {
+		allFlags[command] = make(map[string][]string)
 
-				//Ignore some parameters
-				if parameter.Value.Name == "page[number]" ||
-					parameter.Value.Name == "page[size]" ||
-					parameter.Value.Name == "fields" ||
-					parameter.Value.Name == "Prefer" {
-					continue
-				}
-
-				allFlags[command][renameFlag(parameter.Value.Name)] = []string{}
+		for _, f := range cmd.Flags {
 
-				//Collect valid flag values
-				var enums []any
-				if parameter.Value.Schema.Value.Type.Is("array") &&
-					parameter.Value.Schema.Value.Items != nil &&
-					parameter.Value.Schema.Value.Items.Value.Enum != nil {
-					enums = parameter.Value.Schema.Value.Items.Value.Enum
-				}
+			allFlags[command][f.Name] = []string{}
 
-				if parameter.Value.Schema.Value.Enum != nil {
-					enums = parameter.Value.Schema.Value.Enum
+			//Collect valid flag values, body values are completed with a trailing space
+			for _, enum := range f.Enum {
+				if f.Location == "body" {
+					enum = enum + " "
 				}
-
-				for _, enum := range enums {
-					allFlags[command][renameFlag(parameter.Value.Name)] = append(allFlags[command][renameFlag(parameter.Value.Name)], enum.(string))
-				}
-
-			}
-
-			if object.RequestBody == nil {
-				continue
+				allFlags[command][f.Name] = append(allFlags[command][f.Name], enum)
 			}
 
-			//Get contentType of this command
-			var contentType string
-			for contentType = range object.RequestBody.Value.Content {
-			}
-
-			//If no schema is defined for the body, no need to look for futher fields
-			if object.RequestBody.Value.Content[contentType].Schema == nil {
-				continue
-			}
-
-			//Recursively collect all required fields
-			requiredFlags := collectRequired(object.RequestBody.Value.Content[contentType].Schema.Value)
-
-			var collectAttributes func(*openapi3.Schema, string, string)
-
-			//Function to support nested objects
-			collectAttributes = func(nested *openapi3.Schema, prefix string, inheritType string) {
-
-				//Collect all availble attributes for this command
-				for name, attribute := range nested.Properties {
-
-					//Ignore read-only attributes in body
-					if attribute.Value.ReadOnly {
-						continue
-					}
-
-					flagName := prefix + name
-
-					//Ignore ID-field that is redundant
-					if flagName == "data-id" && inheritType == "" {
-						continue
-					}
-
-					//Nested object, needs to drill down deeper
-					if attribute.Value.Type.Is("object") {
-						collectAttributes(attribute.Value, flagName+"-", "")
-						continue
-					}
-
-					//Arrays might include objects that needs to be drilled down deeper
-					if attribute.Value.Type.Is("array") && attribute.Value.Items.Value.Type.Is("object") {
-						collectAttributes(attribute.Value.Items.Value, flagName+"-", "array")
-						continue
-					}
-
-					required := false
-					if requiredFlags[flagName] {
-						required = true
-					}
-
-					//If flag is required and only one value is available, no need to offer it to the user
-					if required && attribute.Value.Enum != nil && len(attribute.Value.Enum) == 1 {
-						continue
-					}
-
-					//If this is an attribute, strip prefix to shorten flag-names
-					flagName = strings.TrimPrefix(flagName, "data-attributes-")
-
-					//If this is a relationship, strip prefix and -data- to shorten flag-names
-					if strings.HasPrefix(flagName, "data-relationships-") {
-
-						//If this is not the relationship ID field, ignore it
-						if !strings.HasSuffix(flagName, "-id") {
-							continue
-						}
-
-						flagName = strings.TrimPrefix(flagName, "data-relationships-")
-						flagName = strings.Replace(flagName, "-data-id", "-id", 1)
-					}
-
-					flagName = strings.TrimPrefix(flagName, "data-")
-
-					allFlags[command][flagName] = []string{}
-
-					//Collect valid flag values
-					if attribute.Value.Enum != nil {
-						for _, enum := range attribute.Value.Enum {
-							switch v := enum.(type) {
-							case string:
-								allFlags[command][flagName] = append(allFlags[command][flagName], v+" ")
-							case float64:
-								allFlags[command][flagName] = append(allFlags[command][flagName], fmt.Sprintf("%f ", v))
-							}
-						}
-
-					}
-
-					//Collect valid flag values in case of AnyOf
-					if attribute.Value.AnyOf != nil {
-						for _, item := range attribute.Value.AnyOf {
-
-							if item.Value.Enum != nil {
-								for _, enum := range item.Value.Enum {
-									allFlags[command][flagName] = append(allFlags[command][flagName], enum.(string)+" ")
-								}
-							}
-
-						}
-					}
-
-				}
-
-			}
+		}
 
-			collectAttributes(object.RequestBody.Value.Content[contentType].Schema.Value, "", "")
+		if cmd.HasBody {
+			allFlags[command]["body-file"] = []string{}
+		}
 
+		if cmd.Method == "PATCH" && len(listFlags(cmd)) > 0 {
+			allFlags[command]["append"] = []string{}
+			allFlags[command]["remove"] = []string{}
 		}
+
 	}
 
 	return allFlags
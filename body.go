@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// jsonFlag is a flag for a body attribute holding an object or a list of objects.
+// Objects are given as key=value, a JSON object or @file.json, and repeating the
+// flag merges them. Lists are given as a JSON list or @file.json, and repeating
+// the flag appends to the list. The combined value is kept as JSON text in target,
+// so it is checked and sent like every other flag value.
+type jsonFlag struct {
+	target    *string
+	array     bool
+	valueType string // type of the values given as key=value, from additionalProperties
+}
+
+func (j *jsonFlag) String() string {
+	if j.target == nil {
+		return ""
+	}
+	return *j.target
+}
+
+func (j *jsonFlag) Set(value string) error {
+	var parsed any
+	var err error
+
+	trimmed := strings.TrimSpace(value)
+
+	switch {
+	case strings.HasPrefix(value, "@"):
+		var content []byte
+		if content, err = os.ReadFile(value[1:]); err != nil {
+			return err
+		}
+		if parsed, err = decodeJSON(content); err != nil {
+			return fmt.Errorf("%s: %s", value[1:], err)
+		}
+
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		if parsed, err = decodeJSON([]byte(value)); err != nil {
+			return err
+		}
+
+	case !j.array && strings.Contains(value, "="):
+		key, val, _ := strings.Cut(value, "=")
+
+		typed, err := typedValue(val, j.valueType)
+		if err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		parsed = map[string]any{key: typed}
+
+	case j.array:
+		return errors.New("expected a JSON list or @file.json")
+
+	default:
+		return errors.New("expected key=value, a JSON object or @file.json")
+	}
+
+	var current any
+	if *j.target != "" {
+		current, _ = decodeJSON([]byte(*j.target))
+	}
+
+	if j.array {
+		items, ok := parsed.([]any)
+		if !ok {
+			return errors.New("expected a JSON list")
+		}
+
+		list, _ := current.([]any)
+		current = append(list, items...)
+	} else {
+		object, ok := parsed.(map[string]any)
+		if !ok {
+			return errors.New("expected a JSON object")
+		}
+
+		current = deepMerge(current, object)
+	}
+
+	content, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	*j.target = string(content)
+
+	return nil
+}
+
+// decodeJSON parses a JSON document, keeping numbers exactly as written.
+func decodeJSON(content []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// typedValue converts the value of a key=value pair to the type the schema asks for.
+func typedValue(value string, varType string) (any, error) {
+	switch varType {
+	case "boolean":
+		val, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected BOOLEAN, got '%s'", value)
+		}
+		return val, nil
+
+	case "integer":
+		val, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected INTEGER, got '%s'", value)
+		}
+		return val, nil
+
+	case "number":
+		val, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected NUMBER, got '%s'", value)
+		}
+		return val, nil
+	}
+
+	return value, nil
+}
+
+// objectFlagSet reports whether an object flag containing the body path was set,
+// in which case the attribute may come from that object instead of its own flag.
+func objectFlagSet(cmd *IndexCommand, values map[string]*string, path string) bool {
+	for _, f := range cmd.Flags {
+		if f.Type != "object" || !strings.HasPrefix(path, f.Path+".") {
+			continue
+		}
+
+		if value, ok := values[f.Name]; ok && *value != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bodyFlagsGiven reports whether any body attribute was set on the command line.
+func bodyFlagsGiven(cmd *IndexCommand, values map[string]*string, explicit map[string]bool) bool {
+	for _, f := range cmd.Flags {
+		if f.Location == "body" && explicit[f.Name] && *values[f.Name] != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeBody merges flag values onto a body template from stdin or -body-file.
+// Values the CLI fills in by itself, such as the default account and constants,
+// only fill gaps in the template; flags set on the command line override it.
+func mergeBody(template any, cmd *IndexCommand, values map[string]*string, explicit map[string]bool) any {
+	defaults := make(map[string]*string)
+	given := make(map[string]*string)
+
+	for name, value := range values {
+		if explicit[name] {
+			given[name] = value
+		} else {
+			defaults[name] = value
+		}
+	}
+
+	merged := deepMerge(buildRequestBody(cmd, defaults).Data(), template)
+
+	return deepMerge(merged, buildRequestBody(cmd, given).Data())
+}
+
+// deepMerge merges src into dst and returns the result. Objects are merged key by key,
+// anything else in src, lists included, replaces what dst holds.
+func deepMerge(dst any, src any) any {
+	dstMap, dstIsMap := dst.(map[string]any)
+	srcMap, srcIsMap := src.(map[string]any)
+
+	if !dstIsMap || !srcIsMap {
+		return src
+	}
+
+	for key, value := range srcMap {
+		dstMap[key] = deepMerge(dstMap[key], value)
+	}
+
+	return dstMap
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+func TestBuildCommandIndex_Objects(t *testing.T) {
+	cmd := testIndex(t).Commands["create-workspace"]
+
+	tests := []struct {
+		name  string
+		typ   string
+		items string
+		path  string
+	}{
+		{"env-vars", "object", "string", "data.attributes.env-vars"},
+		{"limits", "object", "integer", "data.attributes.limits"},
+		{"vcs-repo", "object", "", "data.attributes.vcs-repo"},
+		{"vcs-repo-branch", "string", "", "data.attributes.vcs-repo.branch"},
+		{"hooks", "array", "object", "data.attributes.hooks"},
+		{"cost", "number", "", "data.attributes.cost"},
+	}
+
+	for _, tt := range tests {
+		f := cmd.flag(tt.name)
+		if f == nil {
+			t.Errorf("flag -%s not in index", tt.name)
+			continue
+		}
+		if f.Type != tt.typ || f.Items != tt.items || f.Path != tt.path {
+			t.Errorf("-%s: got type=%s items=%s path=%s", tt.name, f.Type, f.Items, f.Path)
+		}
+	}
+}
+
+func TestJSONFlag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vcs.json")
+	os.WriteFile(file, []byte(`{"identifier": "org/repo", "branch": "main"}`), 0600)
+
+	var envVars, limits, vcsRepo, hooks string
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&jsonFlag{target: &envVars, valueType: "string"}, "env-vars", "")
+	fs.Var(&jsonFlag{target: &limits, valueType: "integer"}, "limits", "")
+	fs.Var(&jsonFlag{target: &vcsRepo}, "vcs-repo", "")
+	fs.Var(&jsonFlag{target: &hooks, array: true}, "hooks", "")
+
+	err := fs.Parse([]string{
+		"-env-vars=A=1", "-env-vars=B=x=y", `-env-vars={"C": "3"}`,
+		"-limits=runs=5",
+		"-vcs-repo=@" + file,
+		`-hooks=[{"event": "apply"}]`, `-hooks=[{"event": "plan"}]`,
+	})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := map[string]string{
+		"env-vars": `{"A":"1","B":"x=y","C":"3"}`,
+		"limits":   `{"runs":5}`,
+		"vcs-repo": `{"branch":"main","identifier":"org/repo"}`,
+		"hooks":    `[{"event":"apply"},{"event":"plan"}]`,
+	}
+	got := map[string]string{"env-vars": envVars, "limits": limits, "vcs-repo": vcsRepo, "hooks": hooks}
+
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("-%s = %s, want %s", name, got[name], value)
+		}
+	}
+
+	tests := []struct {
+		flag  *jsonFlag
+		value string
+	}{
+		{&jsonFlag{valueType: "integer"}, "runs=many"},
+		{&jsonFlag{}, "novalue"},
+		{&jsonFlag{}, "[1]"},
+		{&jsonFlag{}, "{broken"},
+		{&jsonFlag{array: true}, "a=b"},
+		{&jsonFlag{array: true}, `{"a": "b"}`},
+		{&jsonFlag{}, "@missing.json"},
+	}
+
+	for _, tt := range tests {
+		tt.flag.target = new(string)
+		if err := tt.flag.Set(tt.value); err == nil {
+			t.Errorf("Set(%s): expected an error", tt.value)
+		}
+	}
+}
+
+func TestBuildRequestBody_Objects(t *testing.T) {
+	cmd := testIndex(t).Commands["create-workspace"]
+
+	str := func(s string) *string { return &s }
+
+	body := buildRequestBody(cmd, map[string]*string{
+		"cost":            str("12.5"),
+		"env-vars":        str(`{"A":"1"}`),
+		"vcs-repo":        str(`{"branch":"main","identifier":"org/repo"}`),
+		"vcs-repo-branch": str("dev"),
+		"hooks":           str(`[{"event":"apply"}]`),
+	})
+
+	checks := map[string]interface{}{
+		"data.attributes.cost":                12.5,
+		"data.attributes.env-vars.A":          "1",
+		"data.attributes.vcs-repo.identifier": "org/repo",
+		"data.attributes.vcs-repo.branch":     "dev",
+		"data.attributes.hooks.0.event":       "apply",
+	}
+	for path, want := range checks {
+		if got := body.Path(path).Data(); got != want {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+
+	if !objectFlagSet(cmd, map[string]*string{"vcs-repo": str("{}")}, "data.attributes.vcs-repo.branch") {
+		t.Error("an attribute inside a set object flag should count as given")
+	}
+}
+
+func TestMergeBody(t *testing.T) {
+	cmd := testIndex(t).Commands["create-workspace"]
+
+	template, err := decodeJSON([]byte(`{
+		"data": {
+			"type": "workspaces",
+			"attributes": {"name": "base", "auto-apply": true, "env-vars": {"A": "1", "B": "2"}},
+			"relationships": {"environment": {"data": {"type": "environments", "id": "env-template"}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str := func(s string) *string { return &s }
+
+	values := map[string]*string{
+		"name":           str("prod"),
+		"env-vars":       str(`{"B":"3"}`),
+		"environment-id": str("env-default"),
+		"max-count":      str(""),
+	}
+	explicit := map[string]bool{"name": true, "env-vars": true}
+
+	merged := gabs.Wrap(mergeBody(template, cmd, values, explicit))
+
+	checks := map[string]interface{}{
+		"data.attributes.name":                   "prod",
+		"data.attributes.auto-apply":             true,
+		"data.attributes.env-vars.A":             "1",
+		"data.attributes.env-vars.B":             "3",
+		"data.relationships.environment.data.id": "env-template",
+	}
+	for path, want := range checks {
+		if got := merged.Path(path).Data(); got != want {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+
+	if !bodyFlagsGiven(cmd, values, explicit) {
+		t.Error("expected explicit body flags to be detected")
+	}
+	if bodyFlagsGiven(cmd, values, map[string]bool{"environment-id": false}) {
+		t.Error("defaults filled in by the CLI are not given flags")
+	}
+}
+
+func TestDeepMerge(t *testing.T) {
+	dst := map[string]any{"a": map[string]any{"x": 1, "y": 2}, "list": []any{1, 2}, "keep": true}
+	src := map[string]any{"a": map[string]any{"y": 3}, "list": []any{9}}
+
+	got := gabs.Wrap(deepMerge(dst, src))
+
+	if got.Path("a.x").Data() != 1 || got.Path("a.y").Data() != 3 || got.Path("keep").Data() != true {
+		t.Errorf("unexpected merge result %s", got.String())
+	}
+	if len(got.Path("list").Children()) != 1 {
+		t.Errorf("lists must be replaced, got %s", got.Path("list").String())
+	}
+}
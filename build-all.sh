@@ -25,6 +25,13 @@ echo "Build date: $BUILD_DATE"
 echo "Git commit: $GIT_COMMIT"
 echo "LDFLAGS will set: versionCLI=$VERSION buildDate=$BUILD_DATE gitCommit=$GIT_COMMIT"
 
+# Releases bundle the reviewed OpenAPI spec committed to spec/ as an offline fallback,
+# never one downloaded at build time
+if [ ! -f spec/openapi-public.yml ]; then
+  echo "Error: spec/openapi-public.yml is missing. Run 'make spec', review the changes and commit them before building a release." >&2
+  exit 1
+fi
+
 declare -a os=("linux" "windows" "darwin")
 declare -a arch=("386" "amd64" "arm" "arm64")
 
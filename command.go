@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"io"
@@ -9,11 +8,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
-	"github.com/getkin/kin-openapi/openapi3"
 )
 
 // Exit codes for scripting/CI use
@@ -21,17 +20,47 @@ const (
 	ExitSuccess        = 0 // Command succeeded
 	ExitError          = 1 // Any error (bad input, 4xx, missing flags, not found, etc.)
 	ExitTransientError = 3 // Transient error (5xx, network, timeout) — safe to retry
+	ExitDrift          = 4 // scalr apply -check found resources that differ from the file
+)
+
+// Exit codes of wait-for-run, by how the run ended
+const (
+	ExitPlanChanges          = 2 // Plan-only run finished and the plan has changes, like terraform plan -detailed-exitcode
+	ExitTimeout              = 3 // Run still in progress, or not started yet, when -timeout expired, same as ExitTransientError
+	ExitRunErrored           = 5 // Run errored
+	ExitRunCanceled          = 6 // Run was canceled, force-canceled or discarded
+	ExitRunPolicyBlocked     = 7 // Run waits for a policy override or a cost estimate approval
+	ExitRunNeedsConfirmation = 8 // Run was planned but auto-apply is disabled
 )
 
 // OutputOptions controls how API responses are rendered to the user.
 type OutputOptions struct {
-	Format    string // "json" (default), "table", "csv"
-	Fields    string // comma-separated field list (filters output and controls table/csv column order)
-	Query     string // dot-path expression like ".name" or ".[].id"
-	Quiet     bool   // suppress all output (only exit code matters)
-	Verbose   bool   // print HTTP request/response to stderr
+	Format       string // "json" (default), "table", "csv"
+	Fields       string // comma-separated field list (filters output and controls table/csv column order)
+	Query        string // dot-path expression like ".name" or ".[].id"
+	Quiet        bool   // suppress all output (only exit code matters)
+	Verbose      bool   // print HTTP request/response to stderr
+	ResolveNames bool   // show the names of related resources next to their IDs
+}
+
+// RequestOptions controls how API requests are built and sent.
+type RequestOptions struct {
+	DryRun bool // print the request that would be sent instead of sending it
+	Yes    bool // skip the confirmation prompt for destructive operations
+	Force  bool // allow destructive operations on protected resources
 }
 
+// AssumeOptions controls where credentials obtained by assume-service-account are stored.
+// By default the token is written to credentials.tfrc.json and the top-level settings of scalr.conf.
+type AssumeOptions struct {
+	SaveProfile    string // store the token in this named scalr.conf profile only
+	NoSave         bool   // keep the token in memory only: print it and write nothing
+	ServiceAccount string // email of the assumed service account, recorded in the profile
+}
+
+// assumeOpts is set by parseCommand for the assume-service-account command.
+var assumeOpts AssumeOptions
+
 // PaginationOptions controls how list responses are paginated.
 // Zero values mean "default behavior" (fetch all pages at size 100).
 type PaginationOptions struct {
@@ -39,16 +68,6 @@ type PaginationOptions struct {
 	PageSize int // items per page; 0 means use default (100)
 }
 
-type Parameter struct {
-	varType     string
-	orgName     string
-	description string
-	required    bool
-	enum        []any
-	location    string
-	value       *string
-}
-
 // Command aliases: short names for frequently used commands.
 // Targets must match an actual operation ID (kebab-case) from the OpenAPI spec.
 // If an alias target no longer exists, the CLI will report "Command not found"
@@ -99,9 +118,9 @@ func pascalToKebab(s string) string {
 	return b.String()
 }
 
-func parseCommand(out OutputOptions, page PaginationOptions) {
+func parseCommand(out OutputOptions, page PaginationOptions, request RequestOptions) {
 
-	doc := loadAPI()
+	index := loadIndex()
 
 	command := flag.Arg(0)
 
@@ -114,431 +133,452 @@ func parseCommand(out OutputOptions, page PaginationOptions) {
 		command = target
 	}
 
-	for uri, path := range doc.Paths.Map() {
-		for method, action := range path.Operations() {
-			if strings.ReplaceAll(action.OperationID, "_", "-") != command {
-				continue
-			}
+	cmd, ok := index.Commands[command]
+	if !ok {
+		//Command not found
+		fmt.Fprintf(os.Stderr, "\nCommand '%s' not found. Use -help to list available commands.\n\n", command)
+		os.Exit(ExitError)
+	}
 
-			//Found command, setup flags
-			subFlag := flag.NewFlagSet(command, flag.ExitOnError)
+	method := cmd.Method
+	uri := cmd.Path
 
-			//Disable unwanted built-in flag features
-			subFlag.Usage = func() {}
+	//Found command, setup flags
+	subFlag := flag.NewFlagSet(command, flag.ContinueOnError)
 
-			query := url.Values{}
+	//Disable unwanted built-in flag features
+	subFlag.Usage = func() {}
 
-			contentType := ""
+	query := url.Values{}
 
-			//Will hold all valid flag values
-			flags := make(map[string]Parameter)
+	//Will hold all valid flag values
+	values := make(map[string]*string)
 
-			//Collect all valid URI flags for this command
-			for _, parameter := range action.Parameters {
+	for _, f := range cmd.Flags {
 
-				//Ignore some flags
-				if parameter.Value.Name == "page[number]" ||
-					parameter.Value.Name == "page[size]" ||
-					parameter.Value.Name == "fields" ||
-					parameter.Value.Name == "Prefer" {
-					continue
-				}
+		if f.Location != "body" && f.Type != "string" && f.Type != "boolean" && f.Type != "integer" && f.Type != "number" && f.Type != "array" {
+			//TODO: If code reaches here, means support for new field-type is needed!
+			fmt.Fprintln(os.Stderr, "Warning: Unsupported field type, please report this issue:", f.Param, f.Type)
+			continue
+		}
 
-				if parameter.Value.Schema.Value.Type.Is("string") ||
-					parameter.Value.Schema.Value.Type.Is("boolean") ||
-					parameter.Value.Schema.Value.Type.Is("integer") ||
-					parameter.Value.Schema.Value.Type.Is("array") {
-
-					flags[renameFlag(parameter.Value.Name)] = Parameter{
-						location: parameter.Value.In,
-						varType:  "string",
-						orgName:  parameter.Value.Name,
-						required: parameter.Value.Required,
-						value:    new(string),
-					}
+		values[f.Name] = new(string)
 
-					subFlag.StringVar(flags[renameFlag(parameter.Value.Name)].value, renameFlag(parameter.Value.Name), "", parameter.Value.Description)
+		//Objects and lists of objects are given as JSON, @file.json or, for objects, key=value
+		if f.Type == "object" || f.Items == "object" {
+			subFlag.Var(&jsonFlag{target: values[f.Name], array: f.Type == "array", valueType: f.Items}, f.Name, f.Description)
+			continue
+		}
 
-					continue
-				}
+		subFlag.StringVar(values[f.Name], f.Name, "", f.Description)
+	}
 
-				//TODO: If code reaches here, means support for new field-type is needed!
-				fmt.Fprintln(os.Stderr, "Warning: Unsupported field type, please report this issue:", parameter.Value.Name, parameter.Value.Schema.Value.Type)
+	//Base document the body flags are merged onto, like a body on stdin
+	var bodyFile string
+	if cmd.HasBody {
+		subFlag.StringVar(&bodyFile, "body-file", "", "")
+	}
 
-			}
+	//Modifiers that add to or remove from the current lists instead of replacing them
+	var appendLists, removeLists bool
+	if method == "PATCH" && len(listFlags(cmd)) > 0 {
+		subFlag.BoolVar(&appendLists, "append", false, "")
+		subFlag.BoolVar(&removeLists, "remove", false, "")
+	}
 
-			var requiredFlags map[string]bool
+	//Extra flags that control where assumed credentials are stored
+	if command == "assume-service-account" {
+		subFlag.StringVar(&assumeOpts.SaveProfile, "save-profile", "", "")
+		subFlag.BoolVar(&assumeOpts.NoSave, "no-save", false, "")
+	}
 
-			if method == "POST" || method == "PATCH" || method == "DELETE" {
+	//Find command position in args — use originalArg, not resolved command,
+	//because aliases (e.g. "envs") appear in os.Args, not their target ("list-environments").
+	pos := 1
+	for index, arg := range os.Args {
+		if arg == originalArg {
+			pos = index
+			break
+		}
+	}
 
-				if action.RequestBody != nil {
+	//Validate all flags
+	parseFlags(subFlag, os.Args[pos+1:])
 
-					for contentType = range action.RequestBody.Value.Content {
-					}
+	//Flags given on the command line, as opposed to defaults filled in below
+	explicit := make(map[string]bool)
+	subFlag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
 
-					//If no schema is defined for the body, no need to look for futher fields
-					if action.RequestBody.Value.Content[contentType].Schema != nil {
+	//If command has -account flag and no value set, use default account-ID
+	if value, ok := values["account"]; ok && *value == "" {
+		*value = ScalrAccount
+	}
 
-						//Recursively collect all required fields
-						requiredFlags = collectRequired(action.RequestBody.Value.Content[contentType].Schema.Value)
+	//If command has -account-id flag and no value set, use default account-ID
+	if value, ok := values["account-id"]; ok && *value == "" {
+		*value = ScalrAccount
+	}
 
-						var collectAttributes func(*openapi3.Schema, string, string)
+	var missing []string
+	var missingBody []string
+	var invalid []string
+	var unresolved []string //names left as given in a dry run
 
-						//Function to support nested objects
-						collectAttributes = func(nested *openapi3.Schema, prefix string, inheritType string) {
+	//Sort flag values to correct locations
+	for _, f := range cmd.Flags {
 
-							//Collect all availble attributes for this command
-							for name, attribute := range nested.Properties {
+		value, ok := values[f.Name]
+		if !ok {
+			continue
+		}
 
-								//Ignore read-only attributes in body
-								if attribute.Value.ReadOnly {
-									continue
-								}
+		//On a terminal, a missing resource can be chosen from a list instead. Not in dry runs, they do not call the API
+		if *value == "" && f.Required && (f.Location == "path" || f.Location == "query") && !request.DryRun && canPick() {
+			if id := pickMissing(f.Name); id != "" {
+				subFlag.Set(f.Name, id)
+			}
+		}
 
-								flagName := prefix + name
+		//Ignore empty flags..
+		if *value == "" {
 
-								//Ignore ID-field that is redundant
-								if flagName == "data-id" && inheritType == "" {
-									continue
-								}
+			//..Unless required
+			if f.Required {
+				if f.Location == "query" || f.Location == "path" {
+					missing = append(missing, f.Name)
+				} else if !objectFlagSet(cmd, values, f.Path) {
+					missingBody = append(missingBody, f.Name)
+				}
 
-								//Nested object, needs to drill down deeper
-								if attribute.Value.Type.Is("object") {
-									collectAttributes(attribute.Value, flagName+"-", "")
-									continue
-								}
+			}
 
-								//Arrays might include objects that needs to be drilled down deeper
-								if attribute.Value.Type.Is("array") && attribute.Value.Items.Value.Type.Is("object") {
-									collectAttributes(attribute.Value.Items.Value, flagName+"-", "array")
-									continue
-								}
+			continue
+		}
 
-								// Resolve enum from AnyOf if Type is nil (e.g. provider-name, working-directory)
-								enum := attribute.Value.Enum
-								if attribute.Value.AnyOf != nil {
-									for _, item := range attribute.Value.AnyOf {
-										if item.Value.Enum != nil {
-											enum = item.Value.Enum
-										}
-									}
-								}
+		// Attempt name-to-ID resolution for path/query parameters and relationships.
+		// Dry runs do not call the API, so names are shown as given.
+		if request.DryRun && hasNames(&f, *value) {
+			unresolved = append(unresolved, "-"+f.Name+"="+*value)
+		} else if f.Location == "path" || f.Location == "query" {
+			*value = resolveNameToID(f.Name, *value)
+		} else if f.RelType != "" {
+			*value = resolveRelationshipNames(&f, *value)
+		}
 
-								required := false
-								if requiredFlags[flagName] {
-									required = true
-								}
+		//Check the value against the schema before anything is sent
+		if err := validateFlagValue(&f, *value); err != nil && !(request.DryRun && hasNames(&f, *value)) {
+			invalid = append(invalid, err.Error())
+			continue
+		}
 
-								//If flag is required and only one value is available, no need to offer it to the user
-								if required && enum != nil && len(enum) == 1 {
-									continue
-								}
+		switch f.Location {
+		case "query":
+			//This flag value should be sent as a query parameter
+			query.Add(f.Param, *value)
 
-								flagName = shortenName(flagName)
+		case "path":
+			//This flag value goes in the URI
+			uri = strings.Replace(uri, "{"+f.Param+"}", *value, 1)
+		}
 
-								flags[flagName] = Parameter{
-									location: "body",
-									required: required,
-									enum:     enum,
-									value:    new(string),
-								}
+	}
 
-								subFlag.StringVar(flags[flagName].value, flagName, "", attribute.Value.Description)
+	//Have the API include the related resources shown by -fields, so their names need no lookup
+	if out.ResolveNames && method == "GET" && query.Get("include") == "" {
+		for _, f := range cmd.Flags {
+			if f.Location == "query" && f.Param == "include" {
+				if include := fieldIncludes(f.Enum, out.Fields); len(include) > 0 {
+					query.Set("include", strings.Join(include, ","))
+				}
+			}
+		}
+	}
 
-							}
+	if len(invalid) > 0 {
+		for _, message := range invalid {
+			fmt.Fprintln(os.Stderr, "Error: "+message)
+		}
+		os.Exit(ExitError)
+	}
 
-						}
+	//Show what was chosen as a command that can be copied into scripts
+	if resourcePicked {
+		var flags []string
+		subFlag.Visit(func(f *flag.Flag) {
+			flags = append(flags, "-"+f.Name+"="+f.Value.String())
+		})
+		fmt.Fprintln(os.Stderr, "Command: "+pickedCommand(os.Args[1:pos+1], flags))
+	}
 
-						collectAttributes(action.RequestBody.Value.Content[contentType].Schema.Value, "", "")
+	if appendLists && removeLists {
+		fmt.Fprintln(os.Stderr, "Error: -append and -remove cannot be used together")
+		os.Exit(ExitError)
+	}
 
-					}
+	//Lists the PATCH was based on, checked again right before it is sent
+	var basedOn map[string]string
 
-				}
+	var body string
 
-			}
+	if method == "POST" || method == "PATCH" || method == "DELETE" {
 
-			//Find command position in args — use originalArg, not resolved command,
-			//because aliases (e.g. "envs") appear in os.Args, not their target ("list-environments").
-			pos := 1
-			for index, arg := range os.Args {
-				if arg == originalArg {
-					pos = index
-					break
-				}
-			}
+		//If stdin contains data, use that as Body
+		stat, _ := os.Stdin.Stat()
+		if stat.Mode()&os.ModeNamedPipe != 0 ||
+			(stat.Mode()&os.ModeCharDevice == 0) && stat.Size() > 0 {
 
-			//Validate all flags
-			subFlag.Parse(os.Args[pos+1:])
+			stdin, err := io.ReadAll(os.Stdin)
+			checkErr(err)
 
-			//If command has -account flag and no value set, use default account-ID
-			if flag, ok := flags["account"]; ok && *flag.value == "" {
-				*flag.value = ScalrAccount
-			}
+			body = string(stdin)
+		}
 
-			//If command has -account-id flag and no value set, use default account-ID
-			if flag, ok := flags["account-id"]; ok && *flag.value == "" {
-				*flag.value = ScalrAccount
+		if bodyFile != "" {
+			if strings.TrimSpace(body) != "" {
+				fmt.Fprintln(os.Stderr, "Error: -body-file cannot be used together with a body on stdin")
+				os.Exit(ExitError)
 			}
 
-			var missing []string
-			var missingBody []string
-
-			//Sort flag values to correct locations
-			for name, parameter := range flags {
+			content, err := os.ReadFile(bodyFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: Could not read -body-file:", err)
+				os.Exit(ExitError)
+			}
 
-				//Ignore empty flags..
-				if *parameter.value == "" {
+			body = string(content)
+		}
 
-					//..Unless required
-					if parameter.required {
-						if parameter.location == "query" || parameter.location == "path" {
-							missing = append(missing, name)
-						} else {
-							missingBody = append(missingBody, name)
-						}
+		if strings.TrimSpace(body) != "" {
 
-					}
+			if appendLists || removeLists {
+				fmt.Fprintln(os.Stderr, "Error: -append and -remove cannot be used with a body on stdin or -body-file")
+				os.Exit(ExitError)
+			}
 
-					continue
-				}
+			if len(missing) > 0 {
+				fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
+				os.Exit(ExitError)
+			}
 
-				// Attempt name-to-ID resolution for path/query parameters
-				if parameter.location == "path" || parameter.location == "query" {
-					*parameter.value = resolveNameToID(name, *parameter.value)
+			//Body flags given as well are merged onto the body, which then serves as a template
+			if bodyFlagsGiven(cmd, values, explicit) {
+				template, err := decodeJSON([]byte(body))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Error: The body is not valid JSON, so flags cannot be merged onto it:", err)
+					os.Exit(ExitError)
 				}
 
-				switch parameter.location {
-				case "query":
-					//This flag value should be sent as a query parameter
-					query.Add(parameter.orgName, *parameter.value)
+				body = gabs.Wrap(mergeBody(template, cmd, values, explicit)).StringIndent("", "  ")
+			}
+		} else {
+			body = ""
+		}
 
-				case "path":
-					//This flag value goes in the URI
-					uri = strings.Replace(uri, "{"+parameter.orgName+"}", *parameter.value, 1)
+		if len(body) == 0 {
+			// FIXME: Disable required attributes for PATCH requests as the specs are incorrect
+			if method != "PATCH" {
+				if len(missingBody) > 0 || len(missing) > 0 {
+					fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", append(missing, missingBody...))
+					os.Exit(ExitError)
+				}
+			} else {
+				if len(missing) > 0 {
+					fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
+					os.Exit(ExitError)
 				}
-
 			}
 
-			var body string
+			if cmd.HasBody {
+				raw := buildRequestBody(cmd, values)
 
-			if method == "POST" || method == "PATCH" || method == "DELETE" {
-
-				//If stdin contains data, use that as Body
-				stat, _ := os.Stdin.Stat()
-				if stat.Mode()&os.ModeNamedPipe != 0 ||
-					(stat.Mode()&os.ModeCharDevice == 0) && stat.Size() > 0 {
-
-					if len(missing) > 0 {
-						fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
+				//Read-modify-write: change the current lists instead of replacing them
+				if appendLists || removeLists {
+					var err error
+					basedOn, err = applyListModifiers(cmd, raw, fetchJSON(uri, nil), values, explicit, removeLists)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "Error:", err)
 						os.Exit(ExitError)
 					}
-
-					var stdin []byte
-					scanner := bufio.NewScanner(os.Stdin)
-					for scanner.Scan() {
-						stdin = append(stdin, scanner.Bytes()...)
-					}
-					err := scanner.Err()
-					checkErr(err)
-
-					body = string(stdin)
 				}
 
-				if len(body) == 0 {
-					// FIXME: Disable required attributes for PATCH requests as the specs are incorrect
-					if method != "PATCH" {
-						if len(missingBody) > 0 || len(missing) > 0 {
-							fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", append(missing, missingBody...))
-							os.Exit(ExitError)
-						}
-					} else {
-						if len(missing) > 0 {
-							fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
-							os.Exit(ExitError)
-						}
-					}
-
-					if action.RequestBody != nil {
-						raw := gabs.New()
-
-						var collectAttributes func(*openapi3.Schema, string)
-
-						//Function to support nested objects
-						collectAttributes = func(nested *openapi3.Schema, prefix string) {
-
-							//Collect all availble attributes for this command
-							for name, attribute := range nested.Properties {
-
-								//Ignore read-only attributes in body
-								if attribute.Value.ReadOnly {
-									continue
-								}
-
-								path := prefix + name
+				body = raw.StringIndent("", "  ")
+			}
+		}
 
-								//Nested object, needs to drill down deeper
-								if attribute.Value.Type.Is("object") {
-									collectAttributes(attribute.Value, path+".")
-									continue
-								}
-
-								//Special case for arrays of objects used in relationships
-								isRelationshipArray := attribute.Value.Type.Is("array") &&
-									attribute.Value.Items != nil &&
-									attribute.Value.Items.Value.Type.Is("object")
+	} else {
+		if len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
+			os.Exit(ExitError)
+		}
+	}
 
-								if isRelationshipArray {
-									path = path + ".id"
-								}
+	// Special case for assume-service-account.
+	if command == "assume-service-account" {
+		// Extract hostname from parameter
+		email := values["service-account-email"]
 
-								flagName := strings.ReplaceAll(path, ".", "-")
+		parts := strings.Split(*email, "@")
+		if len(parts) != 2 || parts[1] == "" {
+			fmt.Fprintln(os.Stderr, "Error: Invalid service account email format")
+			os.Exit(ExitError)
+		}
 
-								required := false
-								if requiredFlags[flagName] {
-									required = true
-								}
+		host := parts[1]
 
-								//Special case to auto-add type in relationships if ID is set
-								if strings.HasPrefix(flagName, "data-relationships-") && name == "type" {
-									id := strings.Replace(shortenName(flagName), "-data-type", "-id", 1)
+		// Validate hostname to prevent SSRF attacks
+		if !isValidExternalHost(host) {
+			fmt.Fprintf(os.Stderr, "Error: Invalid hostname '%s' extracted from service account email\n", host)
+			os.Exit(ExitError)
+		}
 
-									if *flags[id].value != "" {
-										required = true
-									} else {
-										required = false
-									}
-								}
+		ScalrHostname = host
 
-								//If required and only one value is available, use it
-								if required && attribute.Value.Enum != nil && len(attribute.Value.Enum) == 1 {
-									raw.SetP(attribute.Value.Enum[0], path)
-									continue
-								}
+		// Refuse a profile that cannot be saved before a token is assumed for it
+		if assumeOpts.SaveProfile != "" {
+			checkSaveProfile(assumeOpts.SaveProfile)
+		}
+		assumeOpts.ServiceAccount = *email
 
-								flagName = shortenName(flagName)
+		if assumeOpts.SaveProfile != "" && assumeOpts.NoSave {
+			fmt.Fprintln(os.Stderr, "Error: -save-profile and -no-save cannot be used together")
+			os.Exit(ExitError)
+		}
+	}
 
-								if _, ok := flags[flagName]; !ok {
-									continue
-								}
+	if request.DryRun {
+		if len(unresolved) > 0 {
+			fmt.Fprintf(os.Stderr, "Note: Names are not resolved to IDs in a dry run: %s\n", strings.Join(unresolved, " "))
+		}
+		printDryRun(method, uri, query, body, cmd.ContentType)
+		return
+	}
 
-								value := *flags[flagName].value
+	//Deleting or destroying something needs confirmation, and is refused for protected resources
+	confirmDestructive(index, cmd, uri, values, request)
 
-								//Skip attribute if not set
-								if value == "" {
-									continue
-								}
+	if basedOn != nil {
+		ensureListsUnchanged(uri, basedOn)
+	}
 
-								theType := attribute.Value.Type
+	//Make request to the API.
+	//The resource type (from the x-resource extension) is used only as a fallback for table
+	//column defaults; formatTable prefers the "type" field from the actual response data.
+	callAPI(method, uri, query, body, cmd.ContentType, cmd.Resource, out, page)
+}
 
-								// Resolve type from AnyOf (e.g. provider-name, working-directory)
-								if theType == nil && attribute.Value.AnyOf != nil {
-									for _, item := range attribute.Value.AnyOf {
-										if item.Value.Type != nil {
-											theType = item.Value.Type
-											break
-										}
-									}
-								}
+// buildRequestBody builds a JSON:API request body from the flag values of a command.
+func buildRequestBody(cmd *IndexCommand, values map[string]*string) *gabs.Container {
+	raw := gabs.New()
 
-								//If no type is specified, it's a relationship
-								if theType == nil {
-									theType = &openapi3.Types{}
-								}
+	//Required attributes with only one possible value are always set
+	for _, constant := range cmd.Constants {
+		raw.SetP(constant.Value, constant.Path)
+	}
 
-								//If this is a relationship, strip prefix and -data- to shorten flag-names
-								if attribute.Value.Type != nil && attribute.Value.Type.Is("object") {
-									flagName = strings.TrimPrefix(flagName, "data-relationships-")
-									flagName = strings.Replace(flagName, "-data-id", "-id", 1)
-								}
+	//Whole objects first, so flags for attributes inside them take precedence
+	flags := append([]IndexFlag{}, cmd.Flags...)
+	sort.SliceStable(flags, func(i, j int) bool {
+		return strings.Count(flags[i].Path, ".") < strings.Count(flags[j].Path, ".")
+	})
 
-								switch {
-								case isRelationshipArray:
-									//Special case for arrays in relationships
-									for _, item := range strings.Split(value, ",") {
-										sub := gabs.New()
-										sub.Set(item, "id")
-										sub.Set(attribute.Value.Items.Value.Properties["type"].Value.Enum[0], "type")
-
-										raw.ArrayAppendP(sub.Data(), strings.TrimSuffix(path, ".id"))
-									}
-
-								case theType.Is("boolean"):
-									val, _ := strconv.ParseBool(value)
-									raw.SetP(val, path)
-
-								case theType.Is("string"):
-									raw.SetP(value, path)
-
-								case theType.Is("integer"):
-									val, _ := strconv.Atoi(value)
-									raw.SetP(val, path)
-
-								case theType.Is("array"):
-									raw.SetP(strings.Split(value, ","), path)
-
-								default:
-									//TODO: If code reaches here, means we need to add support for more field types!
-									fmt.Fprintln(os.Stderr, "Warning: Unsupported field type:", name, attribute.Value.Type)
-								}
-
-							}
+	for _, f := range flags {
 
-						}
+		if f.Location != "body" {
+			continue
+		}
 
-						collectAttributes(action.RequestBody.Value.Content[contentType].Schema.Value, "")
+		//Skip attribute if not set
+		value, ok := values[f.Name]
+		if !ok || *value == "" {
+			continue
+		}
 
-						body = raw.StringIndent("", "  ")
-					}
-				}
+		switch {
+		case f.RelArray:
+			//Special case for arrays in relationships
+			for _, item := range strings.Split(*value, ",") {
+				sub := gabs.New()
+				sub.Set(item, "id")
+				sub.Set(f.RelType, "type")
 
-			} else {
-				if len(missing) > 0 {
-					fmt.Fprintf(os.Stderr, "Missing required flag(s): %s\n", missing)
-					os.Exit(ExitError)
-				}
+				raw.ArrayAppendP(sub.Data(), f.Path)
 			}
 
-			// Special case for assume-service-account.
-			if command == "assume-service-account" {
-				// Extract hostname from parameter
-				email := flags["service-account-email"].value
+		case f.RelType != "":
+			//Relationship ID, the type is added automatically
+			raw.SetP(*value, f.Path)
+			raw.SetP(f.RelType, strings.TrimSuffix(f.Path, ".id")+".type")
+
+		case f.Type == "boolean":
+			val, _ := strconv.ParseBool(*value)
+			raw.SetP(val, f.Path)
+
+		case f.Type == "string":
+			raw.SetP(*value, f.Path)
+
+		case f.Type == "integer":
+			val, _ := strconv.Atoi(*value)
+			raw.SetP(val, f.Path)
+
+		case f.Type == "number":
+			val, _ := strconv.ParseFloat(*value, 64)
+			raw.SetP(val, f.Path)
+
+		case f.Type == "object" || f.Items == "object":
+			//Already checked to be JSON when the flag was parsed
+			val, _ := decodeJSON([]byte(*value))
+			raw.SetP(val, f.Path)
+
+		case f.Type == "array":
+			var items []interface{}
+			for _, item := range strings.Split(*value, ",") {
+				//Already checked to match the item type
+				typed, _ := typedValue(item, f.Items)
+				items = append(items, typed)
+			}
+			raw.SetP(items, f.Path)
 
-				parts := strings.Split(*email, "@")
-				if len(parts) != 2 || parts[1] == "" {
-					fmt.Fprintln(os.Stderr, "Error: Invalid service account email format")
-					os.Exit(ExitError)
-				}
+		default:
+			//TODO: If code reaches here, means we need to add support for more field types!
+			fmt.Fprintln(os.Stderr, "Warning: Unsupported field type:", f.Name, f.Type)
+		}
 
-				host := parts[1]
+	}
 
-				// Validate hostname to prevent SSRF attacks
-				if !isValidExternalHost(host) {
-					fmt.Fprintf(os.Stderr, "Error: Invalid hostname '%s' extracted from service account email\n", host)
-					os.Exit(ExitError)
-				}
+	return raw
+}
 
-				ScalrHostname = host
-			}
+// parseFlags parses the flags of a command. Bad flags exit with ExitError instead of the
+// code 2 the flag package uses, as wait-for-run exits with 2 for plans with changes.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		os.Exit(ExitSuccess)
+	}
+	if err != nil {
+		os.Exit(ExitError)
+	}
+}
 
-			// Detect resource type from the x-resource extension (used for table column defaults).
-			// Used only as a fallback; formatTable prefers the "type" field from the actual response data.
-			resourceType := ""
-			if action.Extensions["x-resource"] != nil {
-				if rt, ok := action.Extensions["x-resource"].(string); ok {
-					resourceType = pascalToKebab(rt)
-				}
-			}
+// Prints the request parseCommand would send, for -dry-run
+func printDryRun(method string, uri string, query url.Values, body string, contentType string) {
+	requestURL := "https://" + ScalrHostname + BasePath + uri
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
 
-			//Make request to the API
-			callAPI(method, uri, query, body, contentType, resourceType, out, page)
+	fmt.Println(method, requestURL)
 
-			return
-		}
+	if contentType != "" {
+		fmt.Println("Content-Type: " + contentType)
 	}
 
-	//Command not found
-	fmt.Fprintf(os.Stderr, "\nCommand '%s' not found. Use -help to list available commands.\n\n", command)
-	os.Exit(ExitError)
+	if body != "" {
+		fmt.Println()
+		fmt.Println(body)
+	}
 }
 
 // Helper function to shorter flag-names for convenience
@@ -681,10 +721,29 @@ func callAPI(method string, uri string, query url.Values, body string, contentTy
 				checkErr(err)
 
 				// Extract token from response
-				token := response.Path("access-token").Data().(string)
+				token, ok := response.Path("access-token").Data().(string)
+				if !ok {
+					fmt.Fprintln(os.Stderr, "Error: Response does not contain an access token")
+					os.Exit(ExitError)
+				}
+
+				switch {
+				case assumeOpts.NoSave:
+					// The token is the whole point of -no-save, so it is printed even with -quiet
+					if out.Quiet {
+						fmt.Println(token)
+					}
+					fmt.Fprintln(os.Stderr, "Token was not saved (-no-save).")
 
-				// Save token to credentials.tfrc.json and scalr.conf
-				addTerraformToken(ScalrHostname, token)
+				case assumeOpts.SaveProfile != "":
+					// Save token to its own profile, leaving the user's credentials untouched
+					expiresAt := assumedTokenExpiry(response, token)
+					saveAssumedProfile(assumeOpts.SaveProfile, ScalrHostname, token, assumeOpts.ServiceAccount, expiresAt)
+
+				default:
+					// Save token to credentials.tfrc.json and scalr.conf
+					addTerraformToken(ScalrHostname, token)
+				}
 			}
 
 			return
@@ -756,6 +815,16 @@ func callAPI(method string, uri string, query url.Values, body string, contentTy
 				output = filterFields(output, out.Fields, isArray)
 			}
 
+			if out.ResolveNames {
+				items := []*gabs.Container{output}
+				if isArray {
+					items = output.Children()
+				}
+
+				resolveRelationshipLabels(items)
+				showRelationshipNames = true
+			}
+
 			// Apply query expression if requested
 			if out.Query != "" {
 				result, isSimple := applyQuery(output, out.Query, isArray)
@@ -787,6 +856,11 @@ func callAPI(method string, uri string, query url.Values, body string, contentTy
 // Uses distinct exit codes: ExitError (1) for 4xx, ExitTransientError (3) for 5xx.
 func showError(resBody []byte, httpStatus ...int) {
 
+	// A cached name may point to a resource that was deleted or renamed since
+	if len(httpStatus) > 0 && httpStatus[0] == http.StatusNotFound {
+		forgetUsedNames()
+	}
+
 	// Determine exit code based on HTTP status
 	exitCode := ExitError
 	if len(httpStatus) > 0 && httpStatus[0] >= 500 {
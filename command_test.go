@@ -1,6 +1,7 @@
 package main
 
 import (
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -323,3 +324,23 @@ func TestParseData_LinksSection(t *testing.T) {
 		t.Errorf("upload-url not preserved, got %s", linksStr)
 	}
 }
+
+func TestPrintDryRun(t *testing.T) {
+	oldHost, oldBase := ScalrHostname, BasePath
+	ScalrHostname, BasePath = "example.scalr.io", "/api/iacp/v3"
+	defer func() { ScalrHostname, BasePath = oldHost, oldBase }()
+
+	query := url.Values{}
+	query.Set("filter[name]", "prod")
+
+	got := captureStdout(t, func() {
+		printDryRun("POST", "/workspaces", query, `{"data": {}}`, "application/vnd.api+json")
+	})
+
+	want := "POST https://example.scalr.io/api/iacp/v3/workspaces?filter%5Bname%5D=prod\n" +
+		"Content-Type: application/vnd.api+json\n\n" +
+		"{\"data\": {}}\n"
+	if got != want {
+		t.Errorf("unexpected dry-run output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// configEnvVars maps settings to the environment variables that override them.
+var configEnvVars = map[string]string{
+	"hostname": "SCALR_HOSTNAME",
+	"token":    "SCALR_TOKEN",
+	"account":  "SCALR_ACCOUNT",
+}
+
+// configSources records where each effective setting came from (flag, env var,
+// profile, legacy flat config, credentials.tfrc.json or default).
+// Only the first source recorded for a setting is kept, so callers must record
+// sources in order of precedence — the same order main() applies them.
+var configSources = map[string]string{}
+
+// setConfigSource records the source of a setting unless one was already recorded.
+func setConfigSource(setting string, source string) {
+	if _, ok := configSources[setting]; ok {
+		return
+	}
+	configSources[setting] = source
+}
+
+// configSetting is one row of `scalr config explain`.
+type configSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// runConfigCommand dispatches `scalr config <subcommand>`.
+func runConfigCommand(subcommand string, format string) {
+	switch subcommand {
+	case "explain":
+		explainConfig(format)
+	case "validate":
+		validateConfigFiles()
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: scalr config <subcommand>")
+		fmt.Fprintln(os.Stderr, "  scalr config explain     Show every effective setting and where it came from")
+		fmt.Fprintln(os.Stderr, "  scalr config validate    Check scalr.conf and credentials.tfrc.json for errors")
+		os.Exit(ExitError)
+	}
+}
+
+// explainConfig prints every effective setting together with its source.
+// Output is a table unless -format=json was given explicitly.
+func explainConfig(format string) {
+	settings := collectConfigSettings(format)
+
+	if format != "" && resolveFormat(format) == "json" {
+		out := gabs.New()
+		out.Array()
+		for _, setting := range settings {
+			out.ArrayAppend(map[string]interface{}{
+				"setting": setting.Name,
+				"value":   setting.Value,
+				"source":  setting.Source,
+			})
+		}
+		fmt.Println(out.StringIndent("", "  "))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	fmt.Fprintln(w, "-------\t-----\t------")
+	for _, setting := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Name, setting.Value, setting.Source)
+	}
+	w.Flush()
+}
+
+// collectConfigSettings gathers the effective settings after main() has applied
+// the layered lookup (env vars, scalr.conf, credentials.tfrc.json, defaults).
+func collectConfigSettings(format string) []configSetting {
+
+	source := func(setting string) string {
+		if s, ok := configSources[setting]; ok {
+			return s
+		}
+		return "default"
+	}
+
+	orNotSet := func(value string) string {
+		if value == "" {
+			return "(not set)"
+		}
+		return value
+	}
+
+	settings := []configSetting{
+		{"hostname", ScalrHostname, source("hostname")},
+		{"account", orNotSet(ScalrAccount), source("account")},
+		{"token", tokenFingerprint(ScalrToken), source("token")},
+		{"profile", orNotSet(ScalrProfile), source("profile")},
+	}
+
+	specPath := specCachePath()
+	specAge := "(not downloaded)"
+	basePath := "(unknown until the spec is downloaded)"
+	basePathSource := "spec servers section"
+
+	if info, err := os.Stat(specPath); err == nil {
+		specAge = time.Since(info.ModTime()).Truncate(time.Second).String()
+
+		if doc, err := newSpecLoader().LoadFromFile(specPath); err == nil {
+			basePath = orNotSet(basePathFromSpec(doc))
+			basePathSource = "spec servers section (" + specPath + ")"
+		}
+	}
+
+	if SpecOverride != "" {
+		settings = append(settings, configSetting{"spec", SpecOverride, source("spec")})
+	}
+
+	settings = append(settings,
+		configSetting{"base-path", basePath, basePathSource},
+		configSetting{"spec-cache", specPath, source("spec-cache")},
+		configSetting{"spec-age", specAge, "refreshed when older than 24h"},
+	)
+
+	colors := "enabled"
+	if colorReset == "" {
+		colors = "disabled"
+	}
+
+	settings = append(settings,
+		configSetting{"colors", colors, source("colors")},
+		configSetting{"format", resolveFormat(format), source("format")},
+	)
+
+	return settings
+}
+
+// tokenFingerprint returns a short, non-reversible identifier for a token so it
+// can be compared across machines without printing the secret itself.
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return "(not set)"
+	}
+
+	sum := sha256.Sum256([]byte(token))
+
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetConfigSource_FirstSourceWins(t *testing.T) {
+	old := configSources
+	configSources = map[string]string{}
+	defer func() { configSources = old }()
+
+	setConfigSource("hostname", "flag")
+	setConfigSource("hostname", "env SCALR_HOSTNAME")
+
+	if got := configSources["hostname"]; got != "flag" {
+		t.Errorf("expected first recorded source to win, got %q", got)
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	if got := tokenFingerprint(""); got != "(not set)" {
+		t.Errorf("empty token should be reported as not set, got %q", got)
+	}
+
+	fp := tokenFingerprint("secret-token")
+	if !strings.HasPrefix(fp, "sha256:") || len(fp) != len("sha256:")+12 {
+		t.Errorf("unexpected fingerprint format: %q", fp)
+	}
+	if strings.Contains(fp, "secret") {
+		t.Errorf("fingerprint must not contain the token: %q", fp)
+	}
+	if fp != tokenFingerprint("secret-token") {
+		t.Error("fingerprint should be stable for the same token")
+	}
+}
+
+func TestAssumedTokenExpiry(t *testing.T) {
+	fromField := assumedTokenExpiry(parseJSONForTest(t, `{"expires-at": "2030-01-02T03:04:05Z"}`), "opaque")
+	if fromField.UTC().Format(time.RFC3339) != "2030-01-02T03:04:05Z" {
+		t.Errorf("expected expiry from expires-at, got %s", fromField)
+	}
+
+	// JWT with payload {"exp": 1900000000}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 1900000000}`))
+	fromJWT := assumedTokenExpiry(parseJSONForTest(t, `{}`), "header."+payload+".signature")
+	if fromJWT.Unix() != 1900000000 {
+		t.Errorf("expected expiry from JWT exp claim, got %s", fromJWT)
+	}
+
+	if unknown := assumedTokenExpiry(parseJSONForTest(t, `{}`), "opaque-token"); !unknown.IsZero() {
+		t.Errorf("expected zero time for opaque token, got %s", unknown)
+	}
+}
+
+func TestSaveAssumedProfile_KeepsOtherSettings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	os.MkdirAll(filepath.Join(home, ".scalr"), 0700)
+	original := `{"default": {"hostname": "mine.scalr.io", "token": "my-token"}}`
+	if err := os.WriteFile(filepath.Join(home, ".scalr", "scalr.conf"), []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	captureStderr(t, func() {
+		saveAssumedProfile("ci", "sa.scalr.io", "assumed-token", "ci@sa.scalr.io", expiresAt)
+	})
+
+	content, err := os.ReadFile(filepath.Join(home, ".scalr", "scalr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := parseJSONForTest(t, string(content))
+
+	if conf.Path("default.token").Data() != "my-token" {
+		t.Errorf("default profile must be untouched, got %s", conf.Path("default"))
+	}
+	if conf.Path("ci.token").Data() != "assumed-token" || conf.Path("ci.hostname").Data() != "sa.scalr.io" {
+		t.Errorf("assumed profile not saved correctly: %s", conf.Path("ci"))
+	}
+	if conf.Path("ci.expires-at").Data() != "2030-01-02T03:04:05Z" {
+		t.Errorf("expiry not recorded: %s", conf.Path("ci"))
+	}
+	if issues := validateScalrConf("scalr.conf", content); len(issues) != 0 {
+		t.Errorf("saved config should validate cleanly, got %v", issues)
+	}
+}
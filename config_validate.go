@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scalrConfSchema lists the keys accepted in scalr.conf and their JSON types.
+// The same keys are valid at the top level (legacy flat format) and inside each profile.
+var scalrConfSchema = map[string]string{
+	"hostname": "string",
+	"token":    "string",
+	"account":  "string",
+
+	// Environment and workspace names or IDs that destructive operations refuse without -force
+	"protected": "array",
+
+	// Written by assume-service-account -save-profile
+	"assumed-service-account": "string",
+	"expires-at":              "string",
+}
+
+// configIssue is a problem found while validating a configuration file.
+type configIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Warning bool
+}
+
+func (issue configIssue) String() string {
+	level := "Error"
+	if issue.Warning {
+		level = "Warning"
+	}
+
+	if issue.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", level, issue.File, issue.Message)
+	}
+
+	return fmt.Sprintf("%s: %s:%d:%d: %s", level, issue.File, issue.Line, issue.Column, issue.Message)
+}
+
+// hasConfigErrors reports whether any issue is an error rather than a warning.
+func hasConfigErrors(issues []configIssue) bool {
+	for _, issue := range issues {
+		if !issue.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// reportConfigIssues prints issues to stderr and exits if any of them is an error.
+// Tab completion requests stay silent, as anything printed would end up in the shell.
+func reportConfigIssues(issues []configIssue) {
+	if os.Getenv("COMP_LINE") == "" {
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+	}
+
+	if hasConfigErrors(issues) {
+		if os.Getenv("COMP_LINE") == "" {
+			fmt.Fprintln(os.Stderr, "Fix the configuration file or run 'scalr config validate' for details.")
+		}
+		os.Exit(ExitError)
+	}
+}
+
+// validateScalrConf checks scalr.conf against scalrConfSchema.
+// Both the legacy flat format and the profile-based format are accepted:
+// a top-level key with an object value is treated as a profile.
+func validateScalrConf(file string, content []byte) []configIssue {
+
+	root, issues := parseConfigJSON(file, content)
+	if root == nil {
+		return issues
+	}
+
+	offsets := jsonKeyOffsets(content)
+
+	issueAt := func(path string, warning bool, format string, args ...interface{}) configIssue {
+		line, column := lineAndColumn(content, offsets[path])
+		return configIssue{
+			File:    file,
+			Line:    line,
+			Column:  column,
+			Message: path + ": " + fmt.Sprintf(format, args...),
+			Warning: warning,
+		}
+	}
+
+	checkSetting := func(path string, key string, value interface{}) {
+		expected, known := scalrConfSchema[key]
+		if !known {
+			message := "unknown key"
+			if suggestion := suggestKey(key, scalrConfSchema); suggestion != "" {
+				message += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+			}
+			issues = append(issues, issueAt(path, true, "%s", message))
+			return
+		}
+
+		if actual := jsonTypeName(value); actual != expected {
+			issues = append(issues, issueAt(path, false, "expected a %s, got %s", expected, actual))
+			return
+		}
+
+		if key == "protected" {
+			for _, item := range value.([]interface{}) {
+				if _, ok := item.(string); !ok {
+					issues = append(issues, issueAt(path, false, "must be a list of names or IDs, got %s in the list", jsonTypeName(item)))
+					break
+				}
+			}
+		}
+
+		if key == "expires-at" {
+			if _, err := time.Parse(time.RFC3339, value.(string)); err != nil {
+				issues = append(issues, issueAt(path, false, "must be an RFC 3339 timestamp like 2026-01-02T15:04:05Z, got '%s'", value))
+			}
+		}
+
+		if key == "hostname" {
+			hostname := value.(string)
+			if strings.Contains(hostname, "://") || strings.Contains(hostname, "/") {
+				issues = append(issues, issueAt(path, false, "must be a bare hostname like example.scalr.io, got '%s'", hostname))
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(root) {
+		value := root[key]
+
+		profile, isProfile := value.(map[string]interface{})
+		if !isProfile {
+			checkSetting(key, key, value)
+			continue
+		}
+
+		for _, setting := range sortedKeys(profile) {
+			checkSetting(key+"."+setting, setting, profile[setting])
+		}
+	}
+
+	return issues
+}
+
+// validateTerraformCredentials checks the parts of credentials.tfrc.json the CLI reads.
+func validateTerraformCredentials(file string, content []byte) []configIssue {
+
+	root, issues := parseConfigJSON(file, content)
+	if root == nil {
+		return issues
+	}
+
+	offsets := jsonKeyOffsets(content)
+
+	issueAt := func(path string, format string, args ...interface{}) configIssue {
+		line, column := lineAndColumn(content, offsets[path])
+		return configIssue{
+			File:    file,
+			Line:    line,
+			Column:  column,
+			Message: path + ": " + fmt.Sprintf(format, args...),
+		}
+	}
+
+	credentials, ok := root["credentials"]
+	if !ok {
+		return issues
+	}
+
+	hosts, ok := credentials.(map[string]interface{})
+	if !ok {
+		return append(issues, issueAt("credentials", "expected an object, got %s", jsonTypeName(credentials)))
+	}
+
+	for _, host := range sortedKeys(hosts) {
+		entry, ok := hosts[host].(map[string]interface{})
+		if !ok {
+			issues = append(issues, issueAt("credentials."+host, "expected an object, got %s", jsonTypeName(hosts[host])))
+			continue
+		}
+
+		if token, ok := entry["token"]; ok && jsonTypeName(token) != "string" {
+			issues = append(issues, issueAt("credentials."+host+".token", "expected a string, got %s", jsonTypeName(token)))
+		}
+	}
+
+	return issues
+}
+
+// parseConfigJSON parses a configuration file that must hold a JSON object.
+// Returns nil and an issue with the location of the syntax error if it does not.
+func parseConfigJSON(file string, content []byte) (map[string]interface{}, []configIssue) {
+	var parsed interface{}
+
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		issue := configIssue{File: file, Message: "invalid JSON: " + err.Error()}
+
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			issue.Line, issue.Column = lineAndColumn(content, syntaxErr.Offset)
+		}
+
+		return nil, []configIssue{issue}
+	}
+
+	root, ok := parsed.(map[string]interface{})
+	if !ok {
+		return nil, []configIssue{{File: file, Line: 1, Column: 1, Message: "expected a JSON object, got " + jsonTypeName(parsed)}}
+	}
+
+	return root, nil
+}
+
+// jsonKeyOffsets maps every object key in a JSON document to the byte offset where it starts.
+// Nested keys are joined with dots, e.g. "default.hostname".
+func jsonKeyOffsets(content []byte) map[string]int64 {
+	offsets := make(map[string]int64)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	var walk func(prefix string) error
+
+	walk = func(prefix string) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		delim, ok := token.(json.Delim)
+		if !ok {
+			return nil
+		}
+
+		for decoder.More() {
+			path := prefix
+
+			if delim == '{' {
+				token, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+
+				key, _ := token.(string)
+				quoted, _ := json.Marshal(key)
+
+				path = strings.TrimPrefix(prefix+"."+key, ".")
+				offsets[path] = decoder.InputOffset() - int64(len(quoted))
+			}
+
+			if err := walk(path); err != nil {
+				return err
+			}
+		}
+
+		//Consume the closing delimiter
+		_, err = decoder.Token()
+		return err
+	}
+
+	walk("")
+
+	return offsets
+}
+
+// lineAndColumn converts a byte offset into a 1-based line and column.
+func lineAndColumn(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	line, column := 1, 1
+	for _, c := range content[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return line, column
+}
+
+// jsonTypeName returns the JSON type name of a decoded value.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// suggestKey returns the known key closest to an unknown one, to catch typos like "acount".
+func suggestKey(key string, known map[string]string) string {
+	best := ""
+	bestDistance := 3 // Anything further away is unlikely to be a typo
+
+	for _, candidate := range sortedKeys(known) {
+		if distance := editDistance(key, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// editDistance computes the Levenshtein distance between two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateConfigFiles validates scalr.conf and credentials.tfrc.json, printing a
+// line per file. Exits with ExitError if any file has errors.
+func validateConfigFiles() {
+	failed := false
+
+	files := []struct {
+		path     string
+		validate func(string, []byte) []configIssue
+	}{
+		{scalrConfigPath(), validateScalrConf},
+		{terraformCredentialsPath(), validateTerraformCredentials},
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: not found, skipped\n", file.path)
+			continue
+		}
+
+		issues := file.validate(file.path, content)
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue)
+		}
+
+		if hasConfigErrors(issues) {
+			failed = true
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: OK\n", file.path)
+	}
+
+	if failed {
+		os.Exit(ExitError)
+	}
+}
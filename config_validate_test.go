@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateScalrConf_Valid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"flat", `{"hostname": "example.scalr.io", "token": "t", "account": "acc-1"}`},
+		{"profiles", `{"default": {"hostname": "a.scalr.io", "token": "t"}, "staging": {"hostname": "b.scalr.io"}}`},
+		{"empty", `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if issues := validateScalrConf("scalr.conf", []byte(tt.content)); len(issues) != 0 {
+				t.Errorf("expected no issues, got %v", issues)
+			}
+		})
+	}
+}
+
+func TestValidateScalrConf_NumericValueIsError(t *testing.T) {
+	content := "{\n  \"default\": {\n    \"token\": 42\n  }\n}"
+
+	issues := validateScalrConf("scalr.conf", []byte(content))
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", issues)
+	}
+
+	issue := issues[0]
+	if issue.Warning {
+		t.Error("type mismatch should be an error, not a warning")
+	}
+	if issue.Line != 3 || issue.Column != 5 {
+		t.Errorf("expected location 3:5, got %d:%d", issue.Line, issue.Column)
+	}
+	if !strings.Contains(issue.Message, "default.token") || !strings.Contains(issue.Message, "got number") {
+		t.Errorf("unexpected message: %s", issue.Message)
+	}
+}
+
+func TestValidateScalrConf_UnknownKeyIsWarningWithSuggestion(t *testing.T) {
+	issues := validateScalrConf("scalr.conf", []byte(`{"acount": "acc-1"}`))
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", issues)
+	}
+	if !issues[0].Warning {
+		t.Error("unknown key should be a warning")
+	}
+	if !strings.Contains(issues[0].Message, "did you mean 'account'") {
+		t.Errorf("expected a suggestion, got %s", issues[0].Message)
+	}
+	if hasConfigErrors(issues) {
+		t.Error("warnings alone must not count as errors")
+	}
+}
+
+func TestValidateScalrConf_HostnameWithScheme(t *testing.T) {
+	issues := validateScalrConf("scalr.conf", []byte(`{"hostname": "https://example.scalr.io"}`))
+	if !hasConfigErrors(issues) {
+		t.Errorf("hostname with scheme should be an error, got %v", issues)
+	}
+}
+
+func TestValidateScalrConf_Protected(t *testing.T) {
+	if issues := validateScalrConf("scalr.conf", []byte(`{"protected": ["prod", "ws-1"]}`)); len(issues) > 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+
+	if issues := validateScalrConf("scalr.conf", []byte(`{"protected": ["prod", 1]}`)); !hasConfigErrors(issues) {
+		t.Errorf("non-string entries should be an error, got %v", issues)
+	}
+}
+
+func TestValidateScalrConf_SyntaxErrorLocation(t *testing.T) {
+	issues := validateScalrConf("scalr.conf", []byte("{\n  \"hostname\": \"a\",\n}"))
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", issues)
+	}
+	if issues[0].Line != 3 {
+		t.Errorf("expected syntax error on line 3, got %d", issues[0].Line)
+	}
+	if !strings.HasPrefix(issues[0].String(), "Error: scalr.conf:3:") {
+		t.Errorf("unexpected rendering: %s", issues[0])
+	}
+}
+
+func TestValidateScalrConf_NotAnObject(t *testing.T) {
+	if issues := validateScalrConf("scalr.conf", []byte(`["a"]`)); !hasConfigErrors(issues) {
+		t.Error("top-level array should be an error")
+	}
+}
+
+func TestValidateTerraformCredentials(t *testing.T) {
+	valid := `{"credentials": {"example.scalr.io": {"token": "t"}}}`
+	if issues := validateTerraformCredentials("tfrc", []byte(valid)); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+
+	invalid := `{"credentials": {"example.scalr.io": {"token": true}}}`
+	issues := validateTerraformCredentials("tfrc", []byte(invalid))
+	if !hasConfigErrors(issues) || !strings.Contains(issues[0].Message, "credentials.example.scalr.io.token") {
+		t.Errorf("expected token type error, got %v", issues)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"account", "account", 0},
+		{"acount", "account", 1},
+		{"hostnmae", "hostname", 2},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
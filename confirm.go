@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"golang.org/x/term"
+)
+
+// guardTarget is the resource a destructive operation acts on, as shown in the
+// confirmation prompt and checked against the protected list.
+type guardTarget struct {
+	Kind    string
+	ID      string
+	Name    string
+	Related map[string]string // IDs of the environment and workspace it belongs to, keyed by type
+}
+
+func (t guardTarget) String() string {
+	if t.Name == "" {
+		return t.Kind + " " + t.ID
+	}
+
+	return fmt.Sprintf("%s '%s' (%s)", t.Kind, t.Name, t.ID)
+}
+
+// destructiveAction returns what a command would do that cannot be undone,
+// or "" if it is not destructive: any DELETE, and runs that destroy infrastructure.
+func destructiveAction(cmd *IndexCommand, values map[string]*string) string {
+	if cmd.Method == "DELETE" {
+		return "Delete"
+	}
+
+	if value, ok := values["is-destroy"]; ok {
+		if destroy, _ := strconv.ParseBool(*value); destroy {
+			return "Destroy the infrastructure of"
+		}
+	}
+
+	return ""
+}
+
+// confirmDestructive guards operations that delete or destroy something. Resources on the
+// protected list of the profile are refused unless -force is given, and on a terminal the
+// user has to confirm unless -yes is given. Non-interactive use is not prompted, so scripts
+// keep working; the target is only looked up when it is needed for either check.
+func confirmDestructive(index *CommandIndex, cmd *IndexCommand, uri string, values map[string]*string, request RequestOptions) {
+	action := destructiveAction(cmd, values)
+	if action == "" {
+		return
+	}
+
+	interactive := !request.Yes && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+
+	if !interactive && len(ScalrProtected) == 0 {
+		return
+	}
+
+	target := describeTarget(index, cmd, uri, values)
+
+	if protectedBy := protectedEntry(target, ScalrProtected); protectedBy != "" {
+		if !request.Force {
+			fmt.Fprintf(os.Stderr, "Error: %s is protected ('%s' in the protected list of the profile). Use -force to continue anyway.\n", target, protectedBy)
+			os.Exit(ExitError)
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %s is protected ('%s' in the protected list of the profile), continuing because of -force.\n", target, protectedBy)
+	}
+
+	if !interactive {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s? [y/N] ", action, target)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	if answer != "y" && answer != "yes" {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+		os.Exit(ExitError)
+	}
+}
+
+// describeTarget looks up the resource a destructive operation acts on: the resource itself
+// if it can be read from the same path, or else the workspace it runs in. Falls back to the
+// most specific ID in the path when neither is available.
+func describeTarget(index *CommandIndex, cmd *IndexCommand, uri string, values map[string]*string) guardTarget {
+	kind := cmd.Resource
+	if kind == "" {
+		kind = "resource"
+	}
+
+	// A deleted resource can be read from its own path, by the first read command found for it
+	if cmd.Method == "DELETE" {
+		for _, other := range index.Commands {
+			if other.Method == "GET" && other.Path == cmd.Path {
+				return targetFromResponse(kind, fetchJSON(uri, nil))
+			}
+		}
+	}
+
+	if workspace, ok := values["workspace-id"]; ok && *workspace != "" {
+		return targetFromResponse("workspace", fetchJSON("/workspaces/"+*workspace, nil))
+	}
+
+	target := guardTarget{Kind: kind}
+
+	for _, f := range cmd.Flags {
+		if f.Location == "path" && *values[f.Name] != "" {
+			target.ID = *values[f.Name]
+		}
+	}
+
+	return target
+}
+
+// targetFromResponse builds a guardTarget from a single-resource API response.
+func targetFromResponse(kind string, response *gabs.Container) guardTarget {
+	data := response.Path("data")
+
+	target := guardTarget{Kind: kind, Related: make(map[string]string)}
+
+	target.ID, _ = data.Path("id").Data().(string)
+	target.Name, _ = data.Path("attributes.name").Data().(string)
+
+	for _, relationship := range []string{"environment", "workspace"} {
+		if id, ok := data.Path("relationships." + relationship + ".data.id").Data().(string); ok {
+			target.Related[relationship+"s"] = id
+		}
+	}
+
+	return target
+}
+
+// protectedEntry returns the entry of the protected list that covers the target: its own
+// name or ID, or the name or ID of the environment or workspace it belongs to.
+func protectedEntry(target guardTarget, protected []string) string {
+	for _, entry := range protected {
+		if entry == target.ID || (target.Name != "" && entry == target.Name) {
+			return entry
+		}
+
+		for _, id := range target.Related {
+			if entry == id {
+				return entry
+			}
+		}
+	}
+
+	//Names such as prod-network look just like IDs, so the related names are always looked up
+	if len(protected) == 0 {
+		return ""
+	}
+
+	for _, kind := range sortedKeys(target.Related) {
+		name, _ := fetchJSON("/"+kind+"/"+target.Related[kind], nil).Path("data.attributes.name").Data().(string)
+
+		for _, entry := range protected {
+			if name != "" && entry == name {
+				return entry
+			}
+		}
+	}
+
+	return ""
+}
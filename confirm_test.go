@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDestructiveAction(t *testing.T) {
+	index := testIndex(t)
+
+	str := func(s string) *string { return &s }
+
+	if destructiveAction(index.Commands["delete-workspace"], map[string]*string{}) != "Delete" {
+		t.Error("DELETE must be destructive")
+	}
+
+	if action := destructiveAction(index.Commands["get-workspace"], map[string]*string{}); action != "" {
+		t.Errorf("GET must not be destructive, got %q", action)
+	}
+
+	run := &IndexCommand{Method: "POST"}
+	if destructiveAction(run, map[string]*string{"is-destroy": str("true")}) == "" {
+		t.Error("destroy runs must be destructive")
+	}
+	if destructiveAction(run, map[string]*string{"is-destroy": str("false")}) != "" {
+		t.Error("plain runs must not be destructive")
+	}
+}
+
+func TestProtectedEntry(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch r.URL.Path {
+		case "/environments/env-1":
+			fmt.Fprint(w, `{"data": {"id": "env-1", "type": "environments", "attributes": {"name": "prod-env"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": [{"status": "404", "title": "Not Found"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	target := guardTarget{Kind: "workspace", ID: "ws-1", Name: "network", Related: map[string]string{"environments": "env-1"}}
+
+	tests := []struct {
+		protected []string
+		want      string
+	}{
+		{nil, ""},
+		{[]string{"ws-1"}, "ws-1"},
+		{[]string{"network"}, "network"},
+		{[]string{"env-1"}, "env-1"},
+		{[]string{"other", "prod-env"}, "prod-env"},
+		{[]string{"other"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := protectedEntry(target, tt.protected); got != tt.want {
+			t.Errorf("protectedEntry(%v) = %q, want %q", tt.protected, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// exporter collects the manifest of a resource and everything in it.
+type exporter struct {
+	index     *CommandIndex
+	resources []manifestResource
+	names     map[string]string // names of related resources, by ID
+	tags      map[string]bool   // tags already in the manifest, by ID
+}
+
+// runExport writes a manifest of the account, an environment or a workspace and the
+// resources in it, in the form `scalr apply` reads. IDs, timestamps and other attributes
+// the API sets by itself are left out, so the manifest can be applied elsewhere.
+func runExport(index *CommandIndex, args []string, format string) {
+	kind := ""
+	if len(args) > 0 {
+		kind, args = args[0], args[1:]
+	}
+
+	identifier := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		identifier, args = args[0], args[1:]
+	}
+
+	exportFlags := flag.NewFlagSet("export", flag.ContinueOnError)
+	exportFlags.Usage = func() {}
+	output := exportFlags.String("o", "", "")
+	parseFlags(exportFlags, args)
+
+	e := &exporter{index: index, names: make(map[string]string), tags: make(map[string]bool)}
+
+	switch {
+	case kind == "account":
+		account := identifier
+		if account == "" {
+			account = ScalrAccount
+		}
+		if account == "" {
+			fmt.Fprintln(os.Stderr, "Error: An account is required. Give its name or ID, or set SCALR_ACCOUNT or the account of your profile.")
+			os.Exit(ExitError)
+		}
+		e.exportAccount(resolveNameToID("account", account))
+
+	case kind == "environment" && identifier != "":
+		e.exportEnvironment(fetchJSON("/environments/"+resolveNameToID("environment", identifier), nil).Path("data"))
+
+	case kind == "workspace" && identifier != "":
+		e.exportWorkspace(fetchJSON("/workspaces/"+resolveNameToID("workspace", identifier), nil).Path("data"))
+
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: scalr export <account|environment|workspace> [name-or-id] [-o file]")
+		fmt.Fprintln(os.Stderr, "  scalr export account                       Everything in the current account")
+		fmt.Fprintln(os.Stderr, "  scalr export environment production        An environment with its workspaces")
+		fmt.Fprintln(os.Stderr, "  scalr export workspace ws-xxx -o ws.yaml   A workspace with its variables and links")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  The manifest is written as YAML, or as JSON with -format=json or an -o file ending in .json")
+		os.Exit(ExitError)
+	}
+
+	var content []byte
+	var err error
+
+	if strings.EqualFold(format, "json") || strings.HasSuffix(*output, ".json") {
+		content, err = json.MarshalIndent(manifest{Resources: e.resources}, "", "  ")
+		content = append(content, '\n')
+	} else {
+		content, err = yaml.Marshal(manifest{Resources: e.resources})
+	}
+	checkErr(err)
+
+	if *output == "" {
+		os.Stdout.Write(content)
+		return
+	}
+
+	if err := os.WriteFile(*output, content, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(ExitError)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d resource(s) to %s\n", len(e.resources), *output)
+}
+
+// exportAccount exports the tags, provider configurations, account variables and
+// environments of an account.
+func (e *exporter) exportAccount(account string) {
+	query := func() url.Values {
+		return url.Values{"filter[account]": {account}}
+	}
+
+	for _, tag := range fetchAll("/tags", query()) {
+		e.exportTag(tag)
+	}
+
+	for _, configuration := range fetchAll("/provider-configurations", query()) {
+		e.add("provider-configuration", configuration)
+	}
+
+	for _, variable := range fetchAll("/vars", query()) {
+		if variable.Search("relationships", "environment", "data", "id").Data() == nil &&
+			variable.Search("relationships", "workspace", "data", "id").Data() == nil {
+			e.add("variable", variable)
+		}
+	}
+
+	for _, environment := range fetchAll("/environments", query()) {
+		e.exportEnvironment(environment)
+	}
+}
+
+// exportEnvironment exports an environment with its variables and workspaces.
+func (e *exporter) exportEnvironment(environment *gabs.Container) {
+	id, _ := environment.Path("id").Data().(string)
+
+	e.add("environment", environment)
+
+	for _, variable := range fetchAll("/vars", url.Values{"filter[environment]": {id}}) {
+		if variable.Search("relationships", "workspace", "data", "id").Data() == nil {
+			e.add("variable", variable)
+		}
+	}
+
+	for _, workspace := range fetchAll("/workspaces", url.Values{"filter[environment]": {id}}) {
+		e.exportWorkspace(workspace)
+	}
+}
+
+// exportWorkspace exports a workspace with its tags, variables, provider configuration
+// links and the run triggers that start it.
+func (e *exporter) exportWorkspace(workspace *gabs.Container) {
+	id, _ := workspace.Path("id").Data().(string)
+
+	//Tags come first, so applying the manifest creates them before they are used
+	for _, tag := range workspace.Search("relationships", "tags", "data").Children() {
+		if tagID, _ := tag.Path("id").Data().(string); !e.tags[tagID] {
+			e.exportTag(fetchJSON("/tags/"+tagID, nil).Path("data"))
+		}
+	}
+
+	e.add("workspace", workspace)
+
+	for _, variable := range fetchAll("/vars", url.Values{"filter[workspace]": {id}}) {
+		e.add("variable", variable)
+	}
+
+	for _, link := range fetchAll("/workspaces/"+id+"/provider-configuration-links", url.Values{}) {
+		link.Set(map[string]any{"type": "workspaces", "id": id}, "relationships", "workspace", "data")
+		e.add("provider-configuration-link", link)
+	}
+
+	for _, trigger := range fetchAll("/run-triggers", url.Values{"filter[downstream]": {id}}) {
+		e.add("run-trigger", trigger)
+	}
+}
+
+func (e *exporter) exportTag(tag *gabs.Container) {
+	id, _ := tag.Path("id").Data().(string)
+	e.tags[id] = true
+
+	e.add("tag", tag)
+}
+
+// add appends an API resource to the manifest.
+func (e *exporter) add(kind string, item *gabs.Container) {
+	e.resources = append(e.resources, e.manifestResource(kind, item))
+}
+
+// manifestResource turns an API resource into a manifest resource. Only the attributes and
+// relationships that can be set are kept, related resources are referred to by name.
+func (e *exporter) manifestResource(kind string, item *gabs.Container) manifestResource {
+	k := manifestKinds[kind]
+	attributes, relationships := writableFields(e.index, k)
+
+	r := manifestResource{Kind: kind, Attributes: make(map[string]any), Relationships: make(map[string]any)}
+
+	for key, value := range item.Path("attributes").ChildrenMap() {
+		switch {
+		case key == "name" && k.Key == "name":
+			r.Name, _ = value.Data().(string)
+		case key == "key" && k.Key == "key":
+			r.Key, _ = value.Data().(string)
+		case value.Data() == nil:
+			//The API never returns the value of a sensitive variable
+			if key == "value" && item.Search("attributes", "sensitive").Data() == true {
+				fmt.Fprintf(os.Stderr, "Warning: The value of sensitive variable '%s' is not exported\n", item.Search("attributes", "key").Data())
+			}
+		case attributes == nil && strings.HasSuffix(key, "-at"):
+			continue
+		case attributes != nil && !attributes[key]:
+			continue
+		default:
+			r.Attributes[key] = value.Data()
+		}
+	}
+
+	for _, name := range k.Scopes {
+		relationships[name] = true
+	}
+
+	for name := range relationships {
+		data := item.Search("relationships", name, "data")
+		if data == nil || data.Data() == nil {
+			continue
+		}
+
+		if list, ok := data.Data().([]any); ok {
+			var names []any
+			for _, related := range data.Children() {
+				names = append(names, e.name(related))
+			}
+			if len(list) > 0 {
+				r.Relationships[name] = names
+			}
+			continue
+		}
+
+		r.Relationships[name] = e.name(data)
+	}
+
+	return r
+}
+
+// name returns the name of a related resource, or its ID if it has no name. Workspaces
+// are qualified with their environment, like production/network.
+func (e *exporter) name(related *gabs.Container) string {
+	id, _ := related.Path("id").Data().(string)
+	relType, _ := related.Path("type").Data().(string)
+
+	if name, ok := e.names[id]; ok {
+		return name
+	}
+
+	related = fetchJSON("/"+relType+"/"+id, nil).Path("data")
+
+	name, ok := related.Search("attributes", "name").Data().(string)
+	if !ok || name == "" {
+		name = id
+	}
+
+	//Workspace names are only unique within their environment
+	if environment := related.Search("relationships", "environment", "data"); relType == "workspaces" && environment != nil && environment.Data() != nil {
+		name = e.name(environment) + "/" + name
+	}
+
+	e.names[id] = name
+
+	return name
+}
+
+// writableFields returns the attributes and relationships of a kind of resource that can be
+// set, as offered by its create and update commands. Read-only attributes, which the index
+// leaves out of the commands, are not among them. The account relationship is left to apply.
+// Attributes are nil if the specification has no such commands.
+func writableFields(index *CommandIndex, kind manifestKind) (map[string]bool, map[string]bool) {
+	attributes := make(map[string]bool)
+	relationships := make(map[string]bool)
+
+	for _, cmd := range writeCommands(index, kind) {
+		for _, f := range cmd.Flags {
+			if name, ok := strings.CutPrefix(f.Path, "data.attributes."); ok {
+				attributes[strings.Split(name, ".")[0]] = true
+			}
+
+			if name, ok := strings.CutPrefix(f.Path, "data.relationships."); ok && !strings.HasPrefix(name, "account.") {
+				relationships[strings.Split(name, ".")[0]] = true
+			}
+		}
+	}
+
+	//Without a command to go by, everything but the timestamps is kept
+	if len(attributes) == 0 {
+		attributes = nil
+	}
+
+	return attributes, relationships
+}
+
+// writeCommands returns the create and update commands of a kind of resource.
+func writeCommands(index *CommandIndex, kind manifestKind) []*IndexCommand {
+	var commands []*IndexCommand
+
+	for _, cmd := range index.Commands {
+		create := cmd.Method == "POST" && cmd.Path == kind.Endpoint
+		update := cmd.Method == "PATCH" && isSingleResourcePath(cmd.Path, kind)
+
+		if create || update {
+			commands = append(commands, cmd)
+		}
+	}
+
+	return commands
+}
+
+// isSingleResourcePath reports whether an API path addresses a single resource of a kind,
+// like /workspaces/{workspace} for workspaces.
+func isSingleResourcePath(path string, kind manifestKind) bool {
+	base := kind.Endpoint
+	if kind.Self != "" {
+		base = kind.Self
+	}
+
+	rest, ok := strings.CutPrefix(path, base+"/{")
+	return ok && strings.HasSuffix(rest, "}") && !strings.Contains(rest, "/")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWritableFields(t *testing.T) {
+	attributes, relationships := writableFields(testIndex(t), manifestKinds["workspace"])
+
+	for _, name := range []string{"auto-apply", "max-count", "env-vars", "vcs-repo"} {
+		if !attributes[name] {
+			t.Errorf("expected %s to be writable", name)
+		}
+	}
+	if attributes["created-at"] {
+		t.Error("read-only attributes must not be writable")
+	}
+
+	if !relationships["environment"] || !relationships["tags"] {
+		t.Errorf("expected environment and tags relationships, got %v", relationships)
+	}
+}
+
+func TestExportWorkspace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch r.URL.Path {
+		case "/environments/env-1":
+			fmt.Fprint(w, `{"data": {"id": "env-1", "type": "environments", "attributes": {"name": "production"}}}`)
+		case "/tags/tag-1":
+			fmt.Fprint(w, `{"data": {"id": "tag-1", "type": "tags", "attributes": {"name": "core", "created-at": "2024-01-01T00:00:00Z"}}}`)
+		case "/workspaces/ws-0":
+			fmt.Fprint(w, `{"data": {"id": "ws-0", "type": "workspaces", "attributes": {"name": "vpc"},
+				"relationships": {"environment": {"data": {"type": "environments", "id": "env-1"}}}}}`)
+		case "/vars":
+			fmt.Fprint(w, `{"data": [{"id": "var-1", "type": "vars",
+				"attributes": {"key": "token", "value": null, "sensitive": true, "category": "shell"},
+				"relationships": {"workspace": {"data": {"type": "workspaces", "id": "ws-1"}}}}]}`)
+		case "/run-triggers":
+			fmt.Fprint(w, `{"data": [{"id": "rt-1", "type": "run-triggers", "attributes": {"created-at": "2024-01-01T00:00:00Z"},
+				"relationships": {"upstream": {"data": {"type": "workspaces", "id": "ws-0"}}, "downstream": {"data": {"type": "workspaces", "id": "ws-1"}}}}]}`)
+		default:
+			fmt.Fprint(w, `{"data": []}`)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	workspace := parseJSONForTest(t, `{"id": "ws-1", "type": "workspaces",
+		"attributes": {"name": "network", "auto-apply": true, "created-at": "2024-01-01T00:00:00Z", "execution-mode": null},
+		"relationships": {
+			"environment": {"data": {"type": "environments", "id": "env-1"}},
+			"tags": {"data": [{"type": "tags", "id": "tag-1"}]}
+		}}`)
+
+	e := &exporter{index: testIndex(t), names: map[string]string{"ws-1": "production/network"}, tags: make(map[string]bool)}
+
+	stderr := captureStderr(t, func() { e.exportWorkspace(workspace) })
+
+	if len(e.resources) != 4 {
+		t.Fatalf("expected tag, workspace, variable and run trigger, got %+v", e.resources)
+	}
+
+	tag := e.resources[0]
+	if tag.Kind != "tag" || tag.Name != "core" || len(tag.Attributes) != 0 {
+		t.Errorf("unexpected tag: %+v", tag)
+	}
+
+	ws := e.resources[1]
+	if ws.Kind != "workspace" || ws.Name != "network" {
+		t.Errorf("unexpected workspace: %+v", ws)
+	}
+	if !reflect.DeepEqual(ws.Attributes, map[string]any{"auto-apply": true}) {
+		t.Errorf("expected only writable, set attributes, got %v", ws.Attributes)
+	}
+	if ws.Relationships["environment"] != "production" || !reflect.DeepEqual(ws.Relationships["tags"], []any{"core"}) {
+		t.Errorf("expected relationships by name, got %v", ws.Relationships)
+	}
+
+	variable := e.resources[2]
+	if variable.Key != "token" || variable.Attributes["value"] != nil || variable.Attributes["category"] != "shell" || variable.Relationships["workspace"] != "production/network" {
+		t.Errorf("unexpected variable: %+v", variable)
+	}
+	if stderr == "" {
+		t.Error("expected a warning about the sensitive value")
+	}
+
+	trigger := e.resources[3]
+	if trigger.Relationships["upstream"] != "production/vpc" || trigger.Relationships["downstream"] != "production/network" {
+		t.Errorf("unexpected run trigger: %+v", trigger)
+	}
+
+	//What is exported can be applied again
+	content, err := yaml.Marshal(manifest{Resources: e.resources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readManifest(writeManifest(t, string(content))); err != nil {
+		t.Errorf("exported manifest cannot be read: %v\n%s", err, content)
+	}
+}
@@ -40,6 +40,10 @@ var defaultColumns = map[string][]string{
 	"policy-checks":            {"id", "status", "scope"},
 }
 
+// showRelationshipNames is set by -resolve-names, so related resources are shown with
+// their names next to their IDs.
+var showRelationshipNames bool
+
 // isTerminal returns true if stdout is connected to a terminal (not piped)
 func isTerminal() bool {
 	return term.IsTerminal(int(os.Stdout.Fd()))
@@ -119,7 +123,7 @@ func formatTable(data *gabs.Container, fields string, resourceType string) {
 	for _, item := range children {
 		vals := make([]string, len(cols))
 		for i, col := range cols {
-			vals[i] = extractValue(item, col)
+			vals[i] = extractValue(item, col, true)
 		}
 		fmt.Fprintln(w, strings.Join(vals, "\t"))
 	}
@@ -154,7 +158,7 @@ func formatKeyValue(data *gabs.Container) {
 
 	for _, k := range keys {
 		v := flat[k]
-		val := formatScalar(v)
+		val := formatCell(v, true)
 		fmt.Printf("%-*s  %s\n", maxLen, strings.ToUpper(k)+":", val)
 	}
 }
@@ -197,7 +201,7 @@ func formatCSV(data *gabs.Container, fields string, resourceType string, isArray
 	for _, item := range children {
 		row := make([]string, len(cols))
 		for i, col := range cols {
-			row[i] = sanitizeCSV(extractValue(item, col))
+			row[i] = sanitizeCSV(extractValue(item, col, false))
 		}
 		w.Write(row)
 	}
@@ -302,17 +306,24 @@ func autoDetectColumns(item *gabs.Container) []string {
 }
 
 // extractValue safely extracts a display-friendly string from a gabs container field.
-func extractValue(item *gabs.Container, field string) string {
+// compactIDs is passed on to formatCell.
+func extractValue(item *gabs.Container, field string, compactIDs bool) string {
 	v := item.Path(field)
 	if v == nil || v.Data() == nil {
 		return ""
 	}
-	return formatScalar(v)
+	return formatCell(v, compactIDs)
 }
 
 // formatScalar converts a gabs value to a display string.
 // Handles *gabs.Container wrappers that parseData creates for id/type fields.
 func formatScalar(v *gabs.Container) string {
+	return formatCell(v, false)
+}
+
+// formatCell converts a gabs value to a display string like formatScalar. With compactIDs,
+// named related resources get a shortened ID, for tables where the name tells them apart.
+func formatCell(v *gabs.Container, compactIDs bool) string {
 	if v == nil || v.Data() == nil {
 		return ""
 	}
@@ -341,8 +352,8 @@ func formatScalar(v *gabs.Container) string {
 		return fmt.Sprintf("%g", val)
 	case map[string]interface{}:
 		// For nested objects, show the ID if available, otherwise compact JSON
-		if id, ok := val["id"]; ok {
-			return fmt.Sprintf("%v", id)
+		if _, ok := val["id"]; ok {
+			return relationshipLabel(val, compactIDs)
 		}
 		return v.String()
 	case []interface{}:
@@ -352,6 +363,10 @@ func formatScalar(v *gabs.Container) string {
 		// For arrays of simple values, join with commas
 		parts := make([]string, 0, len(val))
 		for _, item := range val {
+			if related, ok := unwrapGabs(item).(map[string]interface{}); ok && related["id"] != nil {
+				parts = append(parts, relationshipLabel(related, compactIDs))
+				continue
+			}
 			parts = append(parts, fmt.Sprintf("%v", item))
 		}
 		return strings.Join(parts, ",")
@@ -360,6 +375,38 @@ func formatScalar(v *gabs.Container) string {
 	}
 }
 
+// relationshipLabel renders a related resource as its ID. With -resolve-names, the ID is
+// followed by the name of the resource, and shortened with compactIDs, like env-v0ord… (production).
+func relationshipLabel(related map[string]interface{}, compactIDs bool) string {
+	id := fmt.Sprintf("%v", unwrapGabs(related["id"]))
+
+	name, _ := unwrapGabs(related["name"]).(string)
+	if !showRelationshipNames || name == "" {
+		return id
+	}
+
+	//Keep the type prefix and enough of the rest to tell IDs apart
+	if prefix, rest, ok := strings.Cut(id, "-"); ok && len(rest) > 6 && compactIDs {
+		id = prefix + "-" + rest[:5] + "…"
+	}
+
+	return id + " (" + name + ")"
+}
+
+// unwrapGabs returns the value inside the *gabs.Container wrappers parseData creates.
+func unwrapGabs(v interface{}) interface{} {
+	for {
+		c, ok := v.(*gabs.Container)
+		if !ok {
+			return v
+		}
+		if c == nil {
+			return nil
+		}
+		v = c.Data()
+	}
+}
+
 // sanitizeCSV prevents spreadsheet formula injection by prefixing dangerous
 // starting characters with a single quote. Spreadsheet programs interpret
 // cells starting with =, +, -, @ as formulas.
@@ -109,6 +109,37 @@ func TestFormatScalar(t *testing.T) {
 	}
 }
 
+func TestFormatScalar_RelationshipNames(t *testing.T) {
+	related := map[string]interface{}{"id": "env-v0ord4r0sthdi9es5", "type": "environments", "name": "production"}
+	tags := []interface{}{
+		map[string]interface{}{"id": "tag-v0abc4r0sthdi9es5", "type": "tags", "name": "core"},
+		map[string]interface{}{"id": "tag-1", "type": "tags"},
+	}
+
+	c := gabs.New()
+	c.Set(related)
+	if got := formatScalar(c); got != "env-v0ord4r0sthdi9es5" {
+		t.Errorf("names must only be shown with -resolve-names, got %q", got)
+	}
+
+	showRelationshipNames = true
+	defer func() { showRelationshipNames = false }()
+
+	//CSV keeps the full ID
+	if got := formatScalar(c); got != "env-v0ord4r0sthdi9es5 (production)" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := formatCell(c, true); got != "env-v0ord… (production)" {
+		t.Errorf("got %q", got)
+	}
+
+	c.Set(tags)
+	if got := formatCell(c, true); got != "tag-v0abc… (core),tag-1" {
+		t.Errorf("got %q", got)
+	}
+}
+
 func TestFormatScalar_NilContainer(t *testing.T) {
 	if got := formatScalar(nil); got != "" {
 		t.Errorf("formatScalar(nil) = %q, want empty", got)
@@ -144,7 +175,7 @@ func TestExtractValue(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.field, func(t *testing.T) {
-			if got := extractValue(item, tt.field); got != tt.want {
+			if got := extractValue(item, tt.field, false); got != tt.want {
 				t.Errorf("extractValue(%q) = %q, want %q", tt.field, got, tt.want)
 			}
 		})
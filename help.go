@@ -3,11 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
-	"regexp"
 	"sort"
 	"strings"
-
-	"github.com/getkin/kin-openapi/openapi3"
 )
 
 func printInfo() {
@@ -25,7 +22,9 @@ func printInfo() {
 	fmt.Print("Environment variables:", "\n")
 	fmt.Print("  SCALR_HOSTNAME", "  ", "Scalr Hostname, i.e example.scalr.io", "\n")
 	fmt.Print("  SCALR_TOKEN", "     ", "Scalr API Token", "\n")
-	fmt.Print("  SCALR_ACCOUNT", "   ", "Default Scalr Account ID, i.e acc-tq8cgt2hu6hpfuj", "\n\n")
+	fmt.Print("  SCALR_ACCOUNT", "   ", "Default Scalr Account ID, i.e acc-tq8cgt2hu6hpfuj", "\n")
+	fmt.Print("  SCALR_SPEC", "      ", "Path or URL of the OpenAPI specification to use instead of the cached one", "\n")
+	fmt.Print("  SCALR_NAME_CACHE_TTL", " ", "How long resolved names are cached, i.e 30m (default 1h, 0 turns it off)", "\n\n")
 
 	fmt.Print("Options:", "\n")
 	fmt.Print("  -version", "            ", "Shows current version of this binary", "\n")
@@ -37,16 +36,23 @@ func printInfo() {
 	fmt.Print("  -quiet", "              ", "Disables printing server responses", "\n")
 	fmt.Print("  -format=STRING", "      ", "Output format: json (default), table, csv", "\n")
 	fmt.Print("  -fields=LIST", "        ", "Comma-separated list of fields to include in output (controls table/csv columns too)", "\n")
+	fmt.Print("  -resolve-names", "      ", "Show the names of related resources next to their IDs", "\n")
 	fmt.Print("  -page=INT", "           ", "Fetch only a specific page number (default: fetch all pages)", "\n")
 	fmt.Print("  -page-size=INT", "      ", "Number of items per page (default: 100)", "\n")
 	fmt.Print("  -profile=STRING", "     ", "Use a named configuration profile from scalr.conf", "\n")
 	fmt.Print("  -query=STRING", "       ", "Dot-path expression to extract values (e.g. .name, .[].id)", "\n")
-	fmt.Print("  -no-color", "           ", "Disable colored output (also: NO_COLOR or CI env vars)", "\n\n")
+	fmt.Print("  -no-color", "           ", "Disable colored output (also: NO_COLOR or CI env vars)", "\n")
+	fmt.Print("  -spec=STRING", "        ", "Path or URL of the OpenAPI specification (also: SCALR_SPEC)", "\n")
+	fmt.Print("  -dry-run", "            ", "Print the request that would be sent without sending it", "\n")
+	fmt.Print("  -yes", "                ", "Do not ask for confirmation before deleting or destroying", "\n")
+	fmt.Print("  -force", "              ", "Allow deleting or destroying resources on the protected list of the profile", "\n\n")
 
 	fmt.Print("Exit codes:", "\n")
 	fmt.Print("  0  Success", "\n")
 	fmt.Print("  1  Error (bad input, 4xx, missing flags, not found)", "\n")
-	fmt.Print("  3  Transient error (5xx, network failure, timeout) — safe to retry", "\n\n")
+	fmt.Print("  3  Transient error (5xx, network failure, timeout) — safe to retry", "\n")
+	fmt.Print("  4  scalr apply -check found resources that differ from the file", "\n")
+	fmt.Print("  2, 5-8  wait-for-run: plan changes, errored, canceled, policy blocked, needs confirmation", "\n\n")
 
 	fmt.Print("Aliases:", "\n")
 	for alias, target := range commandAliases {
@@ -65,34 +71,20 @@ func printHelp() {
 		return
 	}
 
-	//Load OpenAPI specification
-	doc := loadAPI()
+	//Load precompiled command index
+	index := loadIndex()
 
 	groups := make(map[string]map[string]string)
 
-	for _, path := range doc.Paths.Map() {
-		for _, method := range path.Operations() {
-
-			group := ""
-
-			if method.Extensions["x-resource"] == nil {
-				//Fallback to Tag if x-resource group is missing
-				group = strings.Title(method.Tags[0])
-			} else {
-				group = method.Extensions["x-resource"].(string)
-			}
-
-			//Add a space before each uppercase letter
-			group = strings.TrimPrefix(string(regexp.MustCompile(`([A-Z])`).ReplaceAll([]byte(group), []byte(" $1"))), " ")
+	for command, cmd := range index.Commands {
 
-			//If group does not exist, add to map
-			if groups[group] == nil {
-				groups[group] = make(map[string]string)
-			}
+		//If group does not exist, add to map
+		if groups[cmd.Group] == nil {
+			groups[cmd.Group] = make(map[string]string)
+		}
 
-			groups[group][strings.ReplaceAll(method.OperationID, "_", "-")] = method.Summary
+		groups[cmd.Group][command] = cmd.Summary
 
-		}
 	}
 
 	//Create a sorted array with group names
@@ -126,6 +118,14 @@ func printHelp() {
 
 }
 
+// helpFlag is one line in the flag list of printHelpCommand.
+type helpFlag struct {
+	varType     string
+	description string
+	required    bool
+	enum        []string
+}
+
 func printHelpCommand(command string) {
 
 	// Resolve aliases
@@ -133,278 +133,135 @@ func printHelpCommand(command string) {
 		command = target
 	}
 
-	//Load OpenAPI specification
-	doc := loadAPI()
-
-	for _, path := range doc.Paths.Map() {
-		for method, object := range path.Operations() {
+	//Load precompiled command index
+	index := loadIndex()
 
-			if command != strings.ReplaceAll(object.OperationID, "_", "-") {
-				continue
-			}
-
-			flags := make(map[string]Parameter)
-
-			for _, parameter := range object.Parameters {
-
-				//Ignore some parameters
-				if parameter.Value.Name == "page[number]" ||
-					parameter.Value.Name == "page[size]" ||
-					parameter.Value.Name == "fields" ||
-					parameter.Value.Name == "Prefer" {
-					continue
-				}
-
-				//Collect valid flag values
-				var enum []any
-				if parameter.Value.Schema.Value.Type.Is("array") &&
-					parameter.Value.Schema.Value.Items != nil &&
-					parameter.Value.Schema.Value.Items.Value.Enum != nil {
-					enum = parameter.Value.Schema.Value.Items.Value.Enum
-				}
-
-				if parameter.Value.Schema.Value.Enum != nil {
-					enum = parameter.Value.Schema.Value.Enum
-				}
-
-				// Convert type to string representation
-				varType := "string"
-				if parameter.Value.Schema.Value.Type.Is("boolean") {
-					varType = "boolean"
-				} else if parameter.Value.Schema.Value.Type.Is("integer") {
-					varType = "integer"
-				} else if parameter.Value.Schema.Value.Type.Is("array") {
-					varType = "array"
-				}
-
-				flags[renameFlag(parameter.Value.Name)] = Parameter{
-					varType:     varType,
-					description: renameFlag(parameter.Value.Description),
-					required:    parameter.Value.Required,
-					enum:        enum,
-				}
-
-			}
-
-			if object.RequestBody == nil {
-				fmt.Printf("\nUsage: scalr [OPTION] %s [FLAGS]\n\n", command)
-			} else {
-
-				//This command requires a body
-				fmt.Printf("\nUsage: scalr [OPTION] %s [FLAGS] [< json-blob.txt]\n\n", command)
-
-				//Get contentType of this command
-				var contentType string
-				for contentType = range object.RequestBody.Value.Content {
-				}
+	cmd, ok := index.Commands[command]
+	if !ok {
+		fmt.Printf("\nCommand '%s' not found. Use -help to list available commands.\n\n", command)
+		return
+	}
 
-				//If no schema is defined for the body, no need to look for futher fields
-				if object.RequestBody.Value.Content[contentType].Schema != nil {
+	flags := make(map[string]helpFlag)
 
-					//Recursively collect all required fields
-					requiredFlags := map[string]bool{}
+	for _, f := range cmd.Flags {
 
-					// FIXME: Disable required attributes for PATCH requests as the specs are incorrect
-					if method != "PATCH" {
-						requiredFlags = collectRequired(object.RequestBody.Value.Content[contentType].Schema.Value)
-					}
-
-					relationshipDesc := make(map[string]string)
-
-					var collectAttributes func(*openapi3.Schema, string, string)
-
-					//Function to support nested objects
-					//TODO: Should probably move this outside of the loop for performance reason, but will make code less readable
-					collectAttributes = func(nested *openapi3.Schema, prefix string, inheritType string) {
-
-						//Collect all availble attributes for this command
-						for name, attribute := range nested.Properties {
-
-							//Special collection of descriptions for relationships
-							if name == "relationships" {
-								for rel, desc := range attribute.Value.Properties {
-									relationshipDesc[rel+"-id"] = desc.Value.Description
-								}
-							}
-
-							//Ignore read-only attributes in body
-							if attribute.Value.ReadOnly {
-								continue
-							}
-
-							flagName := prefix + name
-
-							//Ignore ID-field that is redundant
-							if flagName == "data-id" && inheritType == "" {
-								continue
-							}
-
-							//Nested object, needs to drill down deeper
-							if attribute.Value.Type.Is("object") {
-								collectAttributes(attribute.Value, flagName+"-", "")
-								continue
-							}
-
-							//Arrays might include objects that needs to be drilled down deeper
-							if attribute.Value.Type.Is("array") && attribute.Value.Items.Value.Type.Is("object") {
-								collectAttributes(attribute.Value.Items.Value, flagName+"-", "array")
-								continue
-							}
-
-							required := false
-							if requiredFlags[flagName] {
-								required = true
-							}
-
-							//If flag is required and only one value is available, no need to offer it to the user
-							if required && attribute.Value.Enum != nil && len(attribute.Value.Enum) == 1 {
-								continue
-							}
-
-							description := attribute.Value.Description
-
-							//If this is an attribute, strip prefix to shorten flag-names
-							flagName = strings.TrimPrefix(flagName, "data-attributes-")
-
-							//If this is a relationship, strip prefix and -data- to shorten flag-names
-							if strings.HasPrefix(flagName, "data-relationships-") {
-
-								//If this is not the relationship ID field, ignore it
-								if !strings.HasSuffix(flagName, "-id") {
-									continue
-								}
-
-								flagName = strings.TrimPrefix(flagName, "data-relationships-")
-								flagName = strings.Replace(flagName, "-data-id", "-id", 1)
-
-								//Fetch description from parent instead
-								description = relationshipDesc[flagName]
-							}
-
-							flagName = strings.TrimPrefix(flagName, "data-")
-
-							theType := attribute.Value.Type
-							if inheritType != "" {
-								// Instead of trying to create a new type, we'll use the existing type
-								// and just handle the type conversion in the string representation
-								theType = attribute.Value.Type
-							}
-
-							enum := attribute.Value.Enum
-
-							//Special case: ProviderConfiguration and maybe others?
-							if theType == nil && attribute.Value.AnyOf != nil {
-								for _, item := range attribute.Value.AnyOf {
-									if item.Value.Enum != nil {
-										enum = item.Value.Enum
-									}
-
-									if item.Value.Type != nil {
-										theType = item.Value.Type
-									}
-								}
-							}
-
-							// Convert type to string representation
-							varType := "string"
-							if theType != nil {
-								if theType.Is("boolean") {
-									varType = "boolean"
-								} else if theType.Is("integer") {
-									varType = "integer"
-								} else if theType.Is("array") {
-									varType = "array"
-								} else if theType.Is("object") {
-									varType = "object"
-								}
-							} else if inheritType != "" {
-								varType = inheritType
-							}
-
-							flags[flagName] = Parameter{
-								varType:     varType,
-								description: description,
-								required:    required,
-								enum:        enum,
-							}
-
-						}
-
-					}
-
-					collectAttributes(object.RequestBody.Value.Content[contentType].Schema.Value, "", "")
-
-				}
+		description := f.Description
+		required := f.Required
 
-			}
+		if f.Location != "body" {
+			description = renameFlag(description)
+		} else if cmd.Method == "PATCH" {
+			// FIXME: Disable required attributes for PATCH requests as the specs are incorrect
+			required = false
+		}
 
-			var description string
-			if object.Description != "" {
-				description = object.Description
-			} else if object.Summary != "" {
-				description = object.Summary
-			}
+		flags[f.Name] = helpFlag{
+			varType:     f.Type,
+			description: description,
+			required:    required,
+			enum:        f.Enum,
+		}
+	}
 
-			fmt.Print("  ", strings.ReplaceAll(strings.TrimSpace(description), "\n", "\n  "), "\n")
+	if !cmd.HasBody {
+		fmt.Printf("\nUsage: scalr [OPTION] %s [FLAGS]\n\n", command)
+	} else {
+		//This command requires a body
+		fmt.Printf("\nUsage: scalr [OPTION] %s [FLAGS] [< json-blob.txt]\n\n", command)
+	}
 
-			if len(flags) > 0 {
+	//Extra flags handled by the CLI itself
+	if cmd.HasBody {
+		flags["body-file"] = helpFlag{
+			varType:     "string",
+			description: "Read the request body from a JSON file; other flags given are merged onto it, as for a body on stdin",
+		}
+	}
 
-				fmt.Print("\nFlags:", "\n")
+	if cmd.Method == "PATCH" && len(listFlags(cmd)) > 0 {
+		flags["append"] = helpFlag{
+			varType:     "boolean",
+			description: "Add the values of list flags to the current lists instead of replacing them",
+		}
+		flags["remove"] = helpFlag{
+			varType:     "boolean",
+			description: "Remove the values of list flags from the current lists instead of replacing them",
+		}
+	}
 
-				//Create a sorted array with flags
-				sortedFlags := make([]string, 0, len(flags))
-				maxLength := 0
-				for flg := range flags {
-					sortedFlags = append(sortedFlags, flg)
+	if command == "assume-service-account" {
+		flags["save-profile"] = helpFlag{
+			varType:     "string",
+			description: "Save the token to this named profile in scalr.conf instead of the top-level settings and credentials.tfrc.json",
+		}
+		flags["no-save"] = helpFlag{
+			varType:     "boolean",
+			description: "Keep the token in memory only: print it and write nothing to disk",
+		}
+	}
 
-					completeLength := len(flg + "=" + flags[flg].varType)
+	var description string
+	if cmd.Description != "" {
+		description = cmd.Description
+	} else if cmd.Summary != "" {
+		description = cmd.Summary
+	}
 
-					if completeLength <= maxLength {
-						continue
-					}
+	fmt.Print("  ", strings.ReplaceAll(strings.TrimSpace(description), "\n", "\n  "), "\n")
 
-					maxLength = completeLength
-				}
-				sort.Strings(sortedFlags)
+	if len(flags) > 0 {
 
-				for _, flg := range sortedFlags {
+		fmt.Print("\nFlags:", "\n")
 
-					varType := strings.ToUpper(flags[flg].varType)
-					if varType == "ARRAY" {
-						varType = "LIST"
-					}
+		//Create a sorted array with flags
+		sortedFlags := make([]string, 0, len(flags))
+		maxLength := 0
+		for flg := range flags {
+			sortedFlags = append(sortedFlags, flg)
 
-					completeColor := "-" + flg + colorBlue + "=" + varType + colorReset
-					complete := "-" + flg + "=" + varType
+			completeLength := len(flg + "=" + flags[flg].varType)
 
-					//TODO: IF DESCRIPTION INCLUDES LINK, CONVERT IT TO A HTTP LINK TO THE DOCS
-					description := strings.ReplaceAll(flags[flg].description, "\n", " ")
+			if completeLength <= maxLength {
+				continue
+			}
 
-					if flags[flg].required {
-						description = description + colorRed + " [*required]" + colorReset
-					}
+			maxLength = completeLength
+		}
+		sort.Strings(sortedFlags)
 
-					fmt.Println(" ", completeColor, strings.Repeat(" ", maxLength-len(complete)+1), description)
+		for _, flg := range sortedFlags {
 
-					if flags[flg].enum != nil {
+			varType := displayType(flags[flg].varType)
 
-						options := make([]string, len(flags[flg].enum))
+			completeColor := "-" + flg + colorBlue + "=" + varType + colorReset
+			complete := "-" + flg + "=" + varType
 
-						for index, value := range flags[flg].enum {
-							options[index] = fmt.Sprintf("%v", value)
-						}
+			//TODO: IF DESCRIPTION INCLUDES LINK, CONVERT IT TO A HTTP LINK TO THE DOCS
+			description := strings.ReplaceAll(flags[flg].description, "\n", " ")
 
-						fmt.Println(colorBlue, strings.Repeat(" ", maxLength+3), "[", strings.Join(options, ", "), "]", colorReset)
-					}
-				}
+			if flags[flg].required {
+				description = description + colorRed + " [*required]" + colorReset
 			}
 
-			fmt.Println("")
+			fmt.Println(" ", completeColor, strings.Repeat(" ", maxLength-len(complete)+1), description)
 
-			return
+			if flags[flg].enum != nil {
+				fmt.Println(colorBlue, strings.Repeat(" ", maxLength+3), "[", strings.Join(flags[flg].enum, ", "), "]", colorReset)
+			}
 		}
 	}
 
-	fmt.Printf("\nCommand '%s' not found. Use -help to list available commands.\n\n", command)
+	fmt.Println("")
+
+}
+
+// Returns the flag type as shown to users, i.e. STRING or LIST
+func displayType(varType string) string {
+	varType = strings.ToUpper(varType)
+	if varType == "ARRAY" {
+		return "LIST"
+	}
 
+	return varType
 }
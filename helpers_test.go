@@ -78,3 +78,12 @@ func gabsFromMap(t *testing.T, data map[string]interface{}) *gabs.Container {
 	}
 	return c
 }
+
+// withResolvableTypes makes the types of the test spec resolvable by name, as loadIndex
+// does. Returns a function that restores the previous ones.
+func withResolvableTypes(t *testing.T) func() {
+	t.Helper()
+	old := ResolvableTypes
+	ResolvableTypes = testIndex(t).Resolvable
+	return func() { ResolvableTypes = old }
+}
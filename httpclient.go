@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
+
+	"github.com/Jeffail/gabs/v2"
 )
 
 const (
@@ -88,3 +93,68 @@ func doWithRetry(req *http.Request) (*http.Response, error) {
 	}
 	return nil, lastErr
 }
+
+// fetchJSON sends a GET request to an API path (relative to BasePath) and returns the
+// parsed response. Exits with the API error, or ExitTransientError if the request failed.
+func fetchJSON(apiPath string, query url.Values) *gabs.Container {
+	return sendJSON("GET", apiPath, query, nil)
+}
+
+// fetchAll sends GET requests to a list endpoint until every page has been read and
+// returns the items of all pages. Errors are handled like in fetchJSON.
+func fetchAll(apiPath string, query url.Values) []*gabs.Container {
+	var items []*gabs.Container
+
+	query.Set("page[size]", "100")
+
+	for page := 1; ; page++ {
+		query.Set("page[number]", strconv.Itoa(page))
+
+		response := fetchJSON(apiPath, query)
+		items = append(items, response.Path("data").Children()...)
+
+		if response.Path("meta.pagination.next-page").Data() == nil {
+			return items
+		}
+	}
+}
+
+// sendJSON sends a request with an optional JSON:API body to an API path (relative to
+// BasePath) and returns the parsed response. Errors are handled like in fetchJSON.
+func sendJSON(method string, apiPath string, query url.Values, body []byte) *gabs.Container {
+	apiURL := "https://" + ScalrHostname + BasePath + apiPath
+	if len(query) > 0 {
+		apiURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, apiURL, bytes.NewReader(body))
+	checkErr(err)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.api+json")
+	}
+
+	setScalrHeaders(req)
+
+	res, err := doWithRetry(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Request failed: %s\n", err)
+		os.Exit(ExitTransientError)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	checkErr(err)
+
+	if res.StatusCode >= 300 {
+		showError(resBody, res.StatusCode)
+	}
+
+	response, err := gabs.ParseJSON(resBody)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Invalid API response")
+		os.Exit(ExitError)
+	}
+
+	return response
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// commandIndexVersion must be bumped whenever the index format or the flag derivation
+// changes, so index files written by older binaries are rebuilt instead of misread.
+const commandIndexVersion = 5
+
+// CommandIndex is a compact, precompiled view of the OpenAPI spec holding everything
+// the hot path needs: flag parsing, request building, help and tab completion.
+// It is cached next to the spec and rebuilt whenever the spec file changes, so most
+// invocations never parse or validate the full OpenAPI document.
+type CommandIndex struct {
+	Version   int                      `json:"version"`
+	SpecStamp string                   `json:"spec-stamp"` // identifies the spec file the index was built from
+	BasePath  string                   `json:"base-path"`
+	Commands  map[string]*IndexCommand `json:"commands"` // keyed by kebab-case operation ID
+
+	Resolvable map[string]string `json:"resolvable,omitempty"` // list endpoints with a name filter, by JSON:API type
+}
+
+// IndexCommand describes one API operation.
+type IndexCommand struct {
+	Method      string       `json:"method"`
+	Path        string       `json:"path"`
+	Group       string       `json:"group"`
+	Summary     string       `json:"summary,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Resource    string       `json:"resource,omitempty"` // kebab-case x-resource, used for table column defaults
+	HasBody     bool         `json:"has-body,omitempty"`
+	ContentType string       `json:"content-type,omitempty"`
+	Flags       []IndexFlag  `json:"flags,omitempty"`     // sorted by name
+	Constants   []IndexConst `json:"constants,omitempty"` // body values that are always sent
+}
+
+// IndexFlag describes one flag of a command: a path or query parameter, or a body attribute.
+type IndexFlag struct {
+	Name        string   `json:"name"`
+	Location    string   `json:"in"`              // "path", "query" or "body"
+	Param       string   `json:"param,omitempty"` // original parameter name, for path and query flags
+	Path        string   `json:"path,omitempty"`  // dot-path in the request body, for body flags
+	Type        string   `json:"type"`            // "string", "boolean", "integer", "number", "array" or "object"
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+	RelType     string   `json:"rel-type,omitempty"`  // JSON:API type sent along with a relationship ID
+	RelArray    bool     `json:"rel-array,omitempty"` // relationship holds a list of IDs
+
+	//Validation rules from the schema, checked before a request is sent.
+	//For arrays they apply to each comma-separated item.
+	Items     string   `json:"items,omitempty"` // item type of array flags, value type of map-like object flags
+	Pattern   string   `json:"pattern,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	MinLength uint64   `json:"min-length,omitempty"`
+	MaxLength *uint64  `json:"max-length,omitempty"`
+}
+
+// IndexConst is a body value the user never has to set: a required attribute
+// with exactly one allowed value, such as data.type.
+type IndexConst struct {
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// flag returns the flag with the given name, or nil.
+func (cmd *IndexCommand) flag(name string) *IndexFlag {
+	for i := range cmd.Flags {
+		if cmd.Flags[i].Name == name {
+			return &cmd.Flags[i]
+		}
+	}
+	return nil
+}
+
+// Query parameters the CLI manages itself and never offers as flags
+var ignoredParameters = map[string]bool{
+	"page[number]": true,
+	"page[size]":   true,
+	"fields":       true,
+	"Prefer":       true,
+}
+
+// buildCommandIndex derives every command and its flags from the OpenAPI spec.
+// This is the single place where flag names, types and body paths are worked out.
+func buildCommandIndex(doc *openapi3.T) *CommandIndex {
+
+	index := &CommandIndex{
+		Version:  commandIndexVersion,
+		BasePath: basePathFromSpec(doc),
+		Commands: make(map[string]*IndexCommand),
+	}
+
+	for uri, path := range doc.Paths.Map() {
+		for method, action := range path.Operations() {
+			index.Commands[strings.ReplaceAll(action.OperationID, "_", "-")] = indexOperation(uri, method, action)
+		}
+	}
+
+	index.Resolvable = resolvableTypes(index.Commands)
+
+	return index
+}
+
+// resolvableTypes finds the list operations of the spec that can be filtered by name, like
+// GET /environments, by the JSON:API type they list. Resources of these types can be given
+// by name instead of ID, in relationships as well as path and query parameters.
+func resolvableTypes(commands map[string]*IndexCommand) map[string]string {
+	resolvable := make(map[string]string)
+
+	for _, list := range commands {
+		relType := strings.TrimPrefix(list.Path, "/")
+		if list.Method != "GET" || relType == "" || strings.Contains(relType, "/") {
+			continue
+		}
+
+		for _, filter := range list.Flags {
+			if filter.Location == "query" && filter.Param == "filter[name]" {
+				resolvable[relType] = list.Path
+			}
+		}
+	}
+
+	return resolvable
+}
+
+// indexOperation builds the index entry for a single operation.
+func indexOperation(uri string, method string, action *openapi3.Operation) *IndexCommand {
+
+	cmd := &IndexCommand{
+		Method:      method,
+		Path:        uri,
+		Group:       operationGroup(action),
+		Summary:     action.Summary,
+		Description: action.Description,
+	}
+
+	if rt, ok := action.Extensions["x-resource"].(string); ok {
+		cmd.Resource = pascalToKebab(rt)
+	}
+
+	seen := make(map[string]bool)
+
+	addFlag := func(f IndexFlag) {
+		//The first definition wins if a spec ever reuses a flag name
+		if seen[f.Name] {
+			return
+		}
+		seen[f.Name] = true
+		cmd.Flags = append(cmd.Flags, f)
+	}
+
+	//Collect all valid URI flags for this command
+	for _, parameter := range action.Parameters {
+
+		if parameter.Value == nil || ignoredParameters[parameter.Value.Name] {
+			continue
+		}
+
+		f := IndexFlag{
+			Name:        renameFlag(parameter.Value.Name),
+			Location:    parameter.Value.In,
+			Param:       parameter.Value.Name,
+			Type:        "string",
+			Required:    parameter.Value.Required,
+			Description: parameter.Value.Description,
+		}
+
+		if parameter.Value.Schema != nil && parameter.Value.Schema.Value != nil {
+			schema := parameter.Value.Schema.Value
+
+			f.Type = schemaTypeName(schema.Type)
+
+			//Collect valid flag values
+			if schema.Type.Is("array") && schema.Items != nil && schema.Items.Value.Enum != nil {
+				f.Enum = enumStrings(schema.Items.Value.Enum)
+			}
+
+			if schema.Enum != nil {
+				f.Enum = enumStrings(schema.Enum)
+			}
+
+			applyConstraints(&f, schema)
+		}
+
+		addFlag(f)
+	}
+
+	if action.RequestBody == nil || action.RequestBody.Value == nil {
+		return cmd
+	}
+
+	cmd.HasBody = true
+
+	if method != "POST" && method != "PATCH" && method != "DELETE" {
+		return cmd
+	}
+
+	for cmd.ContentType = range action.RequestBody.Value.Content {
+	}
+
+	//If no schema is defined for the body, no need to look for futher fields
+	media := action.RequestBody.Value.Content[cmd.ContentType]
+	if media == nil || media.Schema == nil {
+		return cmd
+	}
+
+	//Recursively collect all required fields
+	requiredFlags := collectRequired(media.Schema.Value)
+
+	relationshipDesc := make(map[string]string)
+
+	var collectAttributes func(*openapi3.Schema, string)
+
+	//Function to support nested objects
+	collectAttributes = func(nested *openapi3.Schema, prefix string) {
+
+		//Collect all availble attributes for this command
+		for name, attribute := range nested.Properties {
+
+			//Special collection of descriptions for relationships
+			if name == "relationships" && prefix == "data." {
+				for rel, desc := range attribute.Value.Properties {
+					relationshipDesc[rel] = desc.Value.Description
+				}
+			}
+
+			//Ignore read-only attributes in body
+			if attribute.Value.ReadOnly {
+				continue
+			}
+
+			path := prefix + name
+			flagName := strings.ReplaceAll(path, ".", "-")
+
+			//Ignore ID-field that is redundant
+			if path == "data.id" {
+				continue
+			}
+
+			//Nested object, needs to drill down deeper
+			if attribute.Value.Type.Is("object") {
+
+				//Attribute objects can also be given whole, as JSON, @file.json or key=value pairs
+				if strings.HasPrefix(path, "data.attributes.") {
+					f := IndexFlag{
+						Name:        shortenName(flagName),
+						Location:    "body",
+						Path:        path,
+						Type:        "object",
+						Description: attribute.Value.Description,
+					}
+
+					if additional := attribute.Value.AdditionalProperties.Schema; additional != nil && additional.Value != nil {
+						f.Items = schemaTypeName(additional.Value.Type)
+					}
+
+					//Objects with known attributes get a flag per attribute, those carry the required state
+					if len(attribute.Value.Properties) == 0 {
+						f.Required = requiredFlags[flagName]
+					}
+
+					addFlag(f)
+				}
+
+				collectAttributes(attribute.Value, path+".")
+				continue
+			}
+
+			//Relationship type is sent automatically along with the relationship ID
+			if strings.HasPrefix(path, "data.relationships.") && name == "type" {
+				continue
+			}
+
+			//Arrays of objects with an ID are lists of relationships, like tags
+			if attribute.Value.Type.Is("array") && attribute.Value.Items != nil && attribute.Value.Items.Value.Type.Is("object") {
+				items := attribute.Value.Items.Value
+
+				//Arrays of arbitrary objects are given as JSON or @file.json
+				if items.Properties["id"] == nil {
+					addFlag(IndexFlag{
+						Name:        shortenName(flagName),
+						Location:    "body",
+						Path:        path,
+						Type:        "array",
+						Items:       "object",
+						Required:    requiredFlags[flagName],
+						Description: attribute.Value.Description,
+					})
+					continue
+				}
+
+				relType := ""
+				if items.Properties["type"] != nil && len(items.Properties["type"].Value.Enum) > 0 {
+					relType = fmt.Sprintf("%v", items.Properties["type"].Value.Enum[0])
+				}
+
+				relName := strings.TrimSuffix(strings.TrimPrefix(path, "data.relationships."), ".data")
+
+				addFlag(IndexFlag{
+					Name:        shortenName(flagName + "-id"),
+					Location:    "body",
+					Path:        path,
+					Type:        "array",
+					Required:    requiredFlags[flagName],
+					Description: relationshipDescription(relationshipDesc, relName, items.Properties["id"].Value.Description),
+					RelType:     relType,
+					RelArray:    true,
+				})
+				continue
+			}
+
+			// Resolve type and enum from AnyOf if Type is nil (e.g. provider-name, working-directory)
+			theType := attribute.Value.Type
+			enum := attribute.Value.Enum
+			if attribute.Value.AnyOf != nil {
+				for _, item := range attribute.Value.AnyOf {
+					if item.Value.Enum != nil {
+						enum = item.Value.Enum
+					}
+
+					if theType == nil && item.Value.Type != nil {
+						theType = item.Value.Type
+					}
+				}
+			}
+
+			required := requiredFlags[flagName]
+
+			//If flag is required and only one value is available, no need to offer it to the user
+			if required && enum != nil && len(enum) == 1 {
+				cmd.Constants = append(cmd.Constants, IndexConst{Path: path, Value: enum[0]})
+				continue
+			}
+
+			f := IndexFlag{
+				Name:        shortenName(flagName),
+				Location:    "body",
+				Path:        path,
+				Type:        schemaTypeName(theType),
+				Required:    required,
+				Enum:        enumStrings(enum),
+				Description: attribute.Value.Description,
+			}
+
+			applyConstraints(&f, attribute.Value)
+
+			//A relationship ID: the description lives on the relationship, and its type is sent along
+			if strings.HasPrefix(path, "data.relationships.") && name == "id" {
+				relName := strings.TrimSuffix(strings.TrimPrefix(prefix, "data.relationships."), ".data.")
+				f.Description = relationshipDescription(relationshipDesc, relName, f.Description)
+
+				if typeSchema := nested.Properties["type"]; typeSchema != nil && len(typeSchema.Value.Enum) > 0 {
+					f.RelType = fmt.Sprintf("%v", typeSchema.Value.Enum[0])
+				}
+			}
+
+			addFlag(f)
+		}
+	}
+
+	collectAttributes(media.Schema.Value, "")
+
+	sort.Slice(cmd.Flags, func(i, j int) bool { return cmd.Flags[i].Name < cmd.Flags[j].Name })
+	sort.Slice(cmd.Constants, func(i, j int) bool { return cmd.Constants[i].Path < cmd.Constants[j].Path })
+
+	return cmd
+}
+
+// applyConstraints copies the validation rules of a schema onto a flag. For arrays
+// the rules of the items apply, to each comma-separated value.
+func applyConstraints(f *IndexFlag, schema *openapi3.Schema) {
+	if schema.Type.Is("array") && schema.Items != nil && schema.Items.Value != nil {
+		f.Items = schemaTypeName(schema.Items.Value.Type)
+
+		if f.Enum == nil {
+			f.Enum = enumStrings(schema.Items.Value.Enum)
+		}
+
+		schema = schema.Items.Value
+	}
+
+	f.Pattern = schema.Pattern
+	f.Format = schema.Format
+	f.Min = schema.Min
+	f.Max = schema.Max
+	f.MinLength = schema.MinLength
+	f.MaxLength = schema.MaxLength
+}
+
+// relationshipDescription prefers the description of the relationship itself over
+// the description of its ID field.
+func relationshipDescription(descriptions map[string]string, relationship string, fallback string) string {
+	if desc := descriptions[relationship]; desc != "" {
+		return desc
+	}
+	return fallback
+}
+
+// operationGroup returns the help group of an operation: its x-resource, or its first tag.
+func operationGroup(action *openapi3.Operation) string {
+	group := ""
+
+	if rt, ok := action.Extensions["x-resource"].(string); ok {
+		group = rt
+	} else if len(action.Tags) > 0 {
+		//Fallback to Tag if x-resource group is missing
+		group = strings.Title(action.Tags[0])
+	}
+
+	//Add a space before each uppercase letter
+	return strings.TrimPrefix(regexp.MustCompile(`([A-Z])`).ReplaceAllString(group, " $1"), " ")
+}
+
+// schemaTypeName returns the single type name of a schema, defaulting to "string".
+func schemaTypeName(types *openapi3.Types) string {
+	if types == nil {
+		return "string"
+	}
+
+	for _, name := range []string{"boolean", "integer", "number", "array", "object", "string"} {
+		if types.Is(name) {
+			return name
+		}
+	}
+
+	return "string"
+}
+
+// enumStrings converts enum values from the spec to their string form.
+func enumStrings(enum []any) []string {
+	if enum == nil {
+		return nil
+	}
+
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprintf("%v", value)
+	}
+
+	return values
+}
+
+// loadIndex returns the command index for the current spec. The cached index is used
+// as long as the spec file it was built from is unchanged and, for the auto-refreshed
+// cache, does not need a refresh; otherwise the spec is loaded (downloading it if
+// needed) and the index rebuilt.
+func loadIndex() *CommandIndex {
+	specFile, indexFile := indexLocation()
+
+	if indexFile != "" {
+		if info, err := os.Stat(specFile); err == nil && (specFile != specCachePath() || !specNeedsRefresh(specFile, info)) {
+			if index := readIndex(indexFile, specStamp(info)); index != nil {
+				BasePath = index.BasePath
+				ResolvableTypes = index.Resolvable
+				return index
+			}
+		}
+	}
+
+	doc := loadAPI()
+	index := buildCommandIndex(doc)
+	ResolvableTypes = index.Resolvable
+
+	//Only cache the index when the spec came from a file we can stamp, not the bundled fallback
+	if indexFile != "" {
+		if info, err := os.Stat(specFile); err == nil {
+			index.SpecStamp = specStamp(info)
+			writeIndex(indexFile, index)
+		}
+	}
+
+	return index
+}
+
+// indexLocation returns the spec file in use and where its index is cached.
+// The index file is empty when the spec cannot be cached (a URL given to -spec).
+func indexLocation() (string, string) {
+	if specPinned() {
+		return specPinPath(), strings.TrimSuffix(specPinPath(), ".yml") + ".index.json"
+	}
+
+	if SpecOverride == "" {
+		return specCachePath(), strings.TrimSuffix(specCachePath(), ".yml") + ".index.json"
+	}
+
+	if isSpecURL(SpecOverride) {
+		return "", ""
+	}
+
+	//Index of a local spec file is kept in the cache dir, keyed by its path
+	sum := sha256.Sum256([]byte(SpecOverride))
+
+	return SpecOverride, specCacheDir() + "index-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// specNeedsRefresh reports whether a cached spec was downloaded, or last found unchanged
+// upstream, long enough ago to be checked again.
+func specNeedsRefresh(specPath string, info os.FileInfo) bool {
+	checked := info.ModTime()
+	if meta := readSpecMeta(specPath); meta.CheckedAt.After(checked) {
+		checked = meta.CheckedAt
+	}
+
+	return time.Since(checked).Hours() > 24
+}
+
+// specStamp identifies a version of a spec file cheaply, without reading it.
+func specStamp(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// readIndex reads a cached index. Returns nil if it is missing, unreadable,
+// written by an incompatible version or built from a different spec.
+func readIndex(indexFile string, stamp string) *CommandIndex {
+	content, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil
+	}
+
+	var index CommandIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil
+	}
+
+	if index.Version != commandIndexVersion || index.SpecStamp != stamp || index.Commands == nil {
+		return nil
+	}
+
+	return &index
+}
+
+// writeIndex caches an index. Failures are ignored: the index is only an optimization.
+func writeIndex(indexFile string, index *CommandIndex) {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+
+	os.MkdirAll(specCacheDir(), 0700)
+
+	//Write to a temp file first so concurrent invocations never read a partial index
+	tmpFile := fmt.Sprintf("%s.%d.tmp", indexFile, os.Getpid())
+	if err := os.WriteFile(tmpFile, content, 0600); err != nil {
+		return
+	}
+
+	if err := os.Rename(tmpFile, indexFile); err != nil {
+		os.Remove(tmpFile)
+	}
+}
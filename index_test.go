@@ -0,0 +1,145 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func testIndex(t *testing.T) *CommandIndex {
+	t.Helper()
+	return buildCommandIndex(loadSpecOverride(newSpecLoader(), "testdata/openapi-test.yml"))
+}
+
+func TestBuildCommandIndex(t *testing.T) {
+	index := testIndex(t)
+
+	if index.BasePath != "/api/iacp/v3" {
+		t.Errorf("expected base path /api/iacp/v3, got %q", index.BasePath)
+	}
+
+	for _, name := range []string{"get-workspaces", "create-workspace", "get-workspace", "delete-workspace", "list-environments"} {
+		if index.Commands[name] == nil {
+			t.Errorf("expected command %q in index", name)
+		}
+	}
+
+	cmd := index.Commands["create-workspace"]
+	if cmd.Method != "POST" || cmd.Path != "/workspaces" || !cmd.HasBody {
+		t.Errorf("unexpected command: %+v", cmd)
+	}
+	if cmd.Resource != "workspace" {
+		t.Errorf("expected resource workspace, got %q", cmd.Resource)
+	}
+
+	name := cmd.flag("name")
+	if name == nil || !name.Required || name.Path != "data.attributes.name" || name.Type != "string" {
+		t.Errorf("unexpected name flag: %+v", name)
+	}
+
+	env := cmd.flag("environment-id")
+	if env == nil || env.RelType != "environments" || env.RelArray {
+		t.Errorf("unexpected environment-id flag: %+v", env)
+	} else if env.Description != "The environment" {
+		t.Errorf("expected relationship description, got %q", env.Description)
+	}
+
+	tags := cmd.flag("tags-id")
+	if tags == nil || !tags.RelArray || tags.RelType != "tags" {
+		t.Errorf("unexpected tags-id flag: %+v", tags)
+	}
+
+	mode := cmd.flag("execution-mode")
+	if mode == nil || len(mode.Enum) != 2 {
+		t.Errorf("expected execution-mode enum, got %+v", mode)
+	}
+
+	for _, skipped := range []string{"id", "created-at", "type"} {
+		if cmd.flag(skipped) != nil {
+			t.Errorf("flag %q should not be offered", skipped)
+		}
+	}
+
+	if len(cmd.Constants) != 1 || cmd.Constants[0].Path != "data.type" || cmd.Constants[0].Value != "workspaces" {
+		t.Errorf("expected data.type constant, got %+v", cmd.Constants)
+	}
+
+	if index.Resolvable["environments"] != "/environments" || index.Resolvable["workspaces"] != "/workspaces" {
+		t.Errorf("expected environments and workspaces to be resolvable by name, got %v", index.Resolvable)
+	}
+	if _, ok := index.Resolvable["tags"]; ok {
+		t.Error("tags have no list operation in the test spec and must not be resolvable")
+	}
+
+	filter := index.Commands["list-environments"].flag("filter-name")
+	if filter == nil || filter.Location != "query" || filter.Param != "filter[name]" {
+		t.Errorf("unexpected filter-name flag: %+v", filter)
+	}
+}
+
+func TestBuildRequestBody(t *testing.T) {
+	cmd := testIndex(t).Commands["create-workspace"]
+
+	str := func(s string) *string { return &s }
+
+	body := buildRequestBody(cmd, map[string]*string{
+		"name":           str("prod"),
+		"auto-apply":     str("true"),
+		"max-count":      str("3"),
+		"environment-id": str("env-1"),
+		"tags-id":        str("tag-1,tag-2"),
+		"execution-mode": str(""),
+	})
+
+	checks := map[string]interface{}{
+		"data.type":                                "workspaces",
+		"data.attributes.name":                     "prod",
+		"data.attributes.auto-apply":               true,
+		"data.attributes.max-count":                3,
+		"data.relationships.environment.data.id":   "env-1",
+		"data.relationships.environment.data.type": "environments",
+		"data.relationships.tags.data.1.id":        "tag-2",
+		"data.relationships.tags.data.0.type":      "tags",
+	}
+	for path, want := range checks {
+		if got := body.Path(path).Data(); got != want {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+
+	if body.Exists("data", "attributes", "execution-mode") {
+		t.Error("empty flags must not be sent")
+	}
+}
+
+func TestIndexCacheRoundTrip(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	index := testIndex(t)
+	index.SpecStamp = "123-456"
+
+	indexFile := filepath.Join(t.TempDir(), "index.json")
+	writeIndex(indexFile, index)
+
+	cached := readIndex(indexFile, "123-456")
+	if cached == nil {
+		t.Fatal("expected cached index")
+	}
+	if cached.Commands["create-workspace"].flag("tags-id") == nil {
+		t.Error("cached index lost flags")
+	}
+
+	if readIndex(indexFile, "999-456") != nil {
+		t.Error("index built from a different spec must not be used")
+	}
+
+	cached.Version = commandIndexVersion + 1
+	writeIndex(indexFile, cached)
+	if readIndex(indexFile, "123-456") != nil {
+		t.Error("index written by an incompatible version must not be used")
+	}
+
+	if leftovers, _ := filepath.Glob(indexFile + ".*.tmp"); len(leftovers) > 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
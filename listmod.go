@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// listFlags returns the body flags holding a plain list of values or of relationship IDs,
+// the ones -append and -remove apply to.
+func listFlags(cmd *IndexCommand) []IndexFlag {
+	var lists []IndexFlag
+
+	for _, f := range cmd.Flags {
+		if f.Location == "body" && f.Type == "array" && f.Items != "object" {
+			lists = append(lists, f)
+		}
+	}
+
+	return lists
+}
+
+// applyListModifiers turns the list flags given for a PATCH into the complete new lists:
+// the values are added to (-append) or removed from (-remove) the lists in current, the
+// resource as read from the API. Returns the current lists that were changed, keyed by
+// body path, so they can be checked for concurrent edits before the PATCH is sent.
+func applyListModifiers(cmd *IndexCommand, body *gabs.Container, current *gabs.Container, values map[string]*string, explicit map[string]bool, remove bool) (map[string]string, error) {
+	based := make(map[string]string)
+
+	for _, f := range listFlags(cmd) {
+		if !explicit[f.Name] || *values[f.Name] == "" {
+			continue
+		}
+
+		if !current.ExistsP(f.Path) {
+			return nil, fmt.Errorf("the API response does not include the current value of -%s, so it cannot be changed in place", f.Name)
+		}
+
+		existing := current.Path(f.Path)
+		based[f.Path] = existing.String()
+
+		var list []interface{}
+		seen := make(map[string]bool)
+
+		given := make(map[string]bool)
+		for _, item := range strings.Split(*values[f.Name], ",") {
+			given[item] = true
+		}
+
+		//Keep current items, unless they are to be removed
+		for _, item := range existing.Children() {
+			key := listItemKey(f, item)
+
+			if remove && given[key] {
+				continue
+			}
+
+			seen[key] = true
+			list = append(list, item.Data())
+		}
+
+		//Add new items after the current ones, in the order given
+		if !remove {
+			for _, item := range body.Path(f.Path).Children() {
+				key := listItemKey(f, item)
+
+				if !seen[key] {
+					seen[key] = true
+					list = append(list, item.Data())
+				}
+			}
+		}
+
+		if list == nil {
+			list = []interface{}{}
+		}
+
+		body.SetP(list, f.Path)
+	}
+
+	if len(based) == 0 {
+		return nil, errors.New("-append and -remove need at least one list flag, such as " + listFlagNames(cmd))
+	}
+
+	return based, nil
+}
+
+// listItemKey identifies a list item: the ID for relationships, the value otherwise.
+func listItemKey(f IndexFlag, item *gabs.Container) string {
+	if f.RelArray {
+		id, _ := item.Path("id").Data().(string)
+		return id
+	}
+
+	return fmt.Sprintf("%v", item.Data())
+}
+
+// listFlagNames returns the list flags of a command for error messages.
+func listFlagNames(cmd *IndexCommand) string {
+	var names []string
+	for _, f := range listFlags(cmd) {
+		names = append(names, "-"+f.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// ensureListsUnchanged reads the resource again right before the PATCH is sent and
+// stops if any list changed since it was read. This narrows the window for overwriting a
+// concurrent edit but cannot close it, as the API has no conditional PATCH. A change is
+// reported as an error, not as transient, since the lists must be reviewed before retrying.
+func ensureListsUnchanged(uri string, based map[string]string) {
+	current := fetchJSON(uri, nil)
+
+	for path, value := range based {
+		if current.Path(path).String() != value {
+			fmt.Fprintf(os.Stderr, "Error: The list %s was changed by someone else while this command ran. Nothing was sent. Check the current value before running the command again.\n", path)
+			os.Exit(ExitError)
+		}
+	}
+}
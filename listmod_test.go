@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+const currentWorkspace = `{"data": {"id": "ws-1", "type": "workspaces",
+	"attributes": {"name": "prod", "trigger-prefixes": ["modules", "envs"]},
+	"relationships": {"tags": {"data": [{"id": "tag-1", "type": "tags"}, {"id": "tag-2", "type": "tags"}]}}}}`
+
+func TestApplyListModifiers(t *testing.T) {
+	cmd := testIndex(t).Commands["update-workspace"]
+
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		values   map[string]*string
+		remove   bool
+		wantTags []string
+		wantPref []string
+	}{
+		{
+			name:     "append",
+			values:   map[string]*string{"tags-id": str("tag-3,tag-1"), "trigger-prefixes": str("ci")},
+			wantTags: []string{"tag-1", "tag-2", "tag-3"},
+			wantPref: []string{"modules", "envs", "ci"},
+		},
+		{
+			name:     "remove",
+			values:   map[string]*string{"tags-id": str("tag-1,tag-9")},
+			remove:   true,
+			wantTags: []string{"tag-2"},
+		},
+		{
+			name:     "remove all",
+			values:   map[string]*string{"tags-id": str("tag-1,tag-2")},
+			remove:   true,
+			wantTags: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, _ := gabs.ParseJSON([]byte(currentWorkspace))
+
+			explicit := make(map[string]bool)
+			for name := range tt.values {
+				explicit[name] = true
+			}
+
+			body := buildRequestBody(cmd, tt.values)
+
+			based, err := applyListModifiers(cmd, body, current, tt.values, explicit, tt.remove)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var tags []string
+			for _, tag := range body.Path("data.relationships.tags.data").Children() {
+				tags = append(tags, tag.Path("id").Data().(string))
+				if tag.Path("type").Data() != "tags" {
+					t.Errorf("tag %v lost its type", tag.Data())
+				}
+			}
+			if strings.Join(tags, ",") != strings.Join(tt.wantTags, ",") {
+				t.Errorf("tags = %v, want %v", tags, tt.wantTags)
+			}
+
+			if tt.wantPref != nil {
+				var prefixes []string
+				for _, prefix := range body.Path("data.attributes.trigger-prefixes").Children() {
+					prefixes = append(prefixes, prefix.Data().(string))
+				}
+				if strings.Join(prefixes, ",") != strings.Join(tt.wantPref, ",") {
+					t.Errorf("trigger-prefixes = %v, want %v", prefixes, tt.wantPref)
+				}
+			}
+
+			if _, ok := based["data.relationships.tags.data"]; !ok {
+				t.Errorf("expected the current tags to be recorded, got %v", based)
+			}
+		})
+	}
+}
+
+func TestApplyListModifiers_Errors(t *testing.T) {
+	cmd := testIndex(t).Commands["update-workspace"]
+
+	str := func(s string) *string { return &s }
+
+	current, _ := gabs.ParseJSON([]byte(`{"data": {"id": "ws-1", "attributes": {"name": "prod"}}}`))
+
+	values := map[string]*string{"tags-id": str("tag-1")}
+	_, err := applyListModifiers(cmd, buildRequestBody(cmd, values), current, values, map[string]bool{"tags-id": true}, false)
+	if err == nil || !strings.Contains(err.Error(), "-tags-id") {
+		t.Errorf("expected an error about the missing current value of -tags-id, got %v", err)
+	}
+
+	values = map[string]*string{"name": str("x")}
+	_, err = applyListModifiers(cmd, buildRequestBody(cmd, values), current, values, map[string]bool{"name": true}, false)
+	if err == nil || !strings.Contains(err.Error(), "-tags-id") {
+		t.Errorf("expected an error listing the list flags, got %v", err)
+	}
+}
+
+func TestFetchJSON(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/workspaces/ws-1" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("missing authorization header")
+		}
+		fmt.Fprint(w, currentWorkspace)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	response := fetchJSON("/workspaces/ws-1", nil)
+
+	if response.Path("data.attributes.name").Data() != "prod" {
+		t.Errorf("unexpected response %s", response.String())
+	}
+
+	// The lists read above are unchanged, so this must not exit
+	ensureListsUnchanged("/workspaces/ws-1", map[string]string{
+		"data.attributes.trigger-prefixes": response.Path("data.attributes.trigger-prefixes").String(),
+	})
+}
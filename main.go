@@ -1,12 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,10 +17,13 @@ import (
 )
 
 var (
-	ScalrHostname string
-	ScalrToken    string
-	ScalrAccount  string
-	BasePath      string
+	ScalrHostname  string
+	ScalrToken     string
+	ScalrAccount   string
+	ScalrProfile   string
+	BasePath       string
+	SpecOverride   string   // path or URL of the OpenAPI spec, from -spec or SCALR_SPEC
+	ScalrProtected []string // environment and workspace names or IDs that destructive operations refuse
 	// Version information - set at build time
 	versionCLI = "dev"     // Default for development builds
 	buildDate  = "unknown" // Build timestamp
@@ -67,6 +72,11 @@ func main() {
 	profile := flag.String("profile", "", "")
 	queryExpr := flag.String("query", "", "")
 	noColor := flag.Bool("no-color", false, "")
+	specFlag := flag.String("spec", "", "")
+	dryRun := flag.Bool("dry-run", false, "")
+	yes := flag.Bool("yes", false, "")
+	force := flag.Bool("force", false, "")
+	resolveNames := flag.Bool("resolve-names", false, "")
 
 	//Only parse the flags if this is not a tab completion request
 	if os.Getenv("COMP_LINE") == "" {
@@ -80,7 +90,8 @@ func main() {
 			os.Args = []string{os.Args[0], os.Args[2], os.Args[1]}
 		}
 
-		flag.Parse()
+		flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+		parseFlags(flag.CommandLine, os.Args[1:])
 
 		if *version {
 			runVersion()
@@ -106,18 +117,60 @@ func main() {
 
 	// Disable colors in CI environments or when explicitly requested
 	// Respects the NO_COLOR convention (https://no-color.org/)
+	switch {
+	case *noColor:
+		setConfigSource("colors", "flag -no-color")
+	case os.Getenv("NO_COLOR") != "":
+		setConfigSource("colors", "env NO_COLOR")
+	case os.Getenv("CI") != "":
+		setConfigSource("colors", "env CI")
+	}
 	if *noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("CI") != "" {
 		disableColors()
 	}
 
+	if *format != "" {
+		setConfigSource("format", "flag -format")
+	}
+
+	// "config validate" reports problems in the config files itself, so run it before loading them
+	if flag.Arg(0) == "config" && flag.Arg(1) == "validate" {
+		runConfigCommand("validate", *format)
+		return
+	}
+
+	SpecOverride = *specFlag
+	if SpecOverride != "" {
+		setConfigSource("spec", "flag -spec")
+	} else if SpecOverride = os.Getenv("SCALR_SPEC"); SpecOverride != "" {
+		setConfigSource("spec", "env SCALR_SPEC")
+	}
+
 	//Load config from environment
 	ScalrHostname = os.Getenv("SCALR_HOSTNAME")
 	ScalrToken = os.Getenv("SCALR_TOKEN")
 	ScalrAccount = os.Getenv("SCALR_ACCOUNT")
 
+	if value := os.Getenv("SCALR_NAME_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid SCALR_NAME_CACHE_TTL '%s', expected a duration like 30m or 0 to turn the cache off\n", value)
+			os.Exit(ExitError)
+		}
+		nameCacheTTL = ttl
+	}
+
+	for setting, env := range configEnvVars {
+		if os.Getenv(env) != "" {
+			setConfigSource(setting, "env "+env)
+		}
+	}
+
 	// Determine which profile to use
 	activeProfile := *profile
-	if activeProfile == "" {
+	if activeProfile != "" {
+		setConfigSource("profile", "flag -profile")
+	} else {
 		activeProfile = os.Getenv("SCALR_PROFILE")
 	}
 
@@ -131,9 +184,28 @@ func main() {
 
 	if ScalrHostname == "" {
 		ScalrHostname = "scalr.io"
+		setConfigSource("hostname", "default")
 	}
 
-	if ScalrToken == "" && !*help && flag.Arg(0) != "assume-service-account" {
+	// Handle "config" command — inspects local configuration, so it must work before a token is set up
+	if flag.Arg(0) == "config" {
+		runConfigCommand(flag.Arg(1), *format)
+		return
+	}
+
+	// Handle "spec" command — manages the local API specification, no token needed
+	if flag.Arg(0) == "spec" {
+		runSpecCommand(flag.Args()[1:])
+		return
+	}
+
+	// Handle "cache" command — manages the local name cache, no token needed
+	if flag.Arg(0) == "cache" {
+		runCacheCommand(flag.Args()[1:])
+		return
+	}
+
+	if ScalrToken == "" && !*help && !*dryRun && flag.Arg(0) != "assume-service-account" {
 		//End here if this is a completion request
 		if os.Getenv("COMP_LINE") != "" {
 			return
@@ -157,10 +229,18 @@ func main() {
 	// Handle built-in commands that bypass OpenAPI
 	if flag.Arg(0) == "wait-for-run" {
 		// Parse sub-flags for wait-for-run
-		waitFlags := flag.NewFlagSet("wait-for-run", flag.ExitOnError)
+		waitFlags := flag.NewFlagSet("wait-for-run", flag.ContinueOnError)
 		waitFlags.Usage = func() {}
 		waitRun := waitFlags.String("run", "", "")
+		waitWorkspace := waitFlags.String("workspace", "", "")
+		waitSince := waitFlags.String("since", "", "")
 		waitTimeout := waitFlags.Duration("timeout", 30*time.Minute, "")
+		waitLogs := waitFlags.Bool("logs", false, "")
+		waitOnPlanned := waitFlags.String("on-planned", "", "")
+		waitOnPolicySoftFail := waitFlags.String("on-policy-soft-fail", "", "")
+		waitOnCostEstimated := waitFlags.String("on-cost-estimated", "", "")
+		waitComment := waitFlags.String("comment", "", "")
+		waitEvents := waitFlags.String("events", "", "")
 
 		// Find command position in args
 		pos := 1
@@ -170,19 +250,74 @@ func main() {
 				break
 			}
 		}
-		waitFlags.Parse(os.Args[pos+1:])
+		parseFlags(waitFlags, os.Args[pos+1:])
+
+		// Need to load the command index to set BasePath
+		loadIndex()
 
-		// Need to load API to set BasePath
-		doc := loadAPI()
-		_ = doc
-		waitForRun(*waitRun, *waitTimeout)
+		if *waitRun != "" && *waitWorkspace != "" {
+			fmt.Fprintln(os.Stderr, "Error: -run and -workspace cannot be used together")
+			os.Exit(ExitError)
+		}
+
+		if *waitSince != "" && *waitWorkspace == "" {
+			fmt.Fprintln(os.Stderr, "Error: -since needs -workspace")
+			os.Exit(ExitError)
+		}
+
+		// Several runs are given as a list, or piped in
+		runIDs := splitRunIDs(*waitRun)
+		if *waitRun == "" && *waitWorkspace == "" {
+			runIDs = readRunIDs()
+		}
+
+		opts := WaitOptions{
+			Timeout:          *waitTimeout,
+			Logs:             *waitLogs,
+			OnPlanned:        *waitOnPlanned,
+			OnPolicySoftFail: *waitOnPolicySoftFail,
+			Comment:          *waitComment,
+			Events:           *waitEvents,
+		}
+
+		if err := validateEventsFormat(opts.Events); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+			os.Exit(ExitError)
+		}
+
+		if err := validateWaitPolicies(&opts, *waitOnCostEstimated); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+			os.Exit(ExitError)
+		}
+
+		if len(runIDs) > 1 {
+			if opts.Logs {
+				fmt.Fprintln(os.Stderr, "Error: -logs can only follow a single run")
+				os.Exit(ExitError)
+			}
+
+			waitForRuns(runIDs, opts)
+			return
+		}
+
+		// Wait for the run of a workspace to appear first, all within the same timeout
+		runID := ""
+		if len(runIDs) == 1 {
+			runID = runIDs[0]
+		}
+		if *waitWorkspace != "" {
+			deadline := time.Now().Add(*waitTimeout)
+			runID = findRun(resolveNameToID("workspace", *waitWorkspace), *waitSince, deadline)
+			opts.Timeout = time.Until(deadline)
+		}
+
+		waitForRun(runID, opts)
 		return
 	}
 
 	// Handle "open" command — opens Scalr dashboard in browser
 	if flag.Arg(0) == "open" {
-		doc := loadAPI()
-		_ = doc
+		loadIndex()
 
 		resourceType := flag.Arg(1)
 		identifier := flag.Arg(2)
@@ -200,20 +335,38 @@ func main() {
 		return
 	}
 
+	// Handle "apply" command — creates or updates the resources of a manifest file
+	if flag.Arg(0) == "apply" {
+		runApply(loadIndex(), flag.Args()[1:], *dryRun)
+		return
+	}
+
+	// Handle "export" command — writes a manifest that "apply" can read
+	if flag.Arg(0) == "export" {
+		runExport(loadIndex(), flag.Args()[1:], *format)
+		return
+	}
+
 	// Determine output format — JSON is always the default for backward compatibility.
 	out := OutputOptions{
-		Format:  resolveFormat(*format),
-		Fields:  *fields,
-		Query:   *queryExpr,
-		Quiet:   *quiet,
-		Verbose: *verbose,
+		Format:       resolveFormat(*format),
+		Fields:       *fields,
+		Query:        *queryExpr,
+		Quiet:        *quiet,
+		Verbose:      *verbose,
+		ResolveNames: *resolveNames,
 	}
 	page := PaginationOptions{
 		Page:     *pageNum,
 		PageSize: *pageSize,
 	}
+	request := RequestOptions{
+		DryRun: *dryRun,
+		Yes:    *yes,
+		Force:  *force,
+	}
 
-	parseCommand(out, page)
+	parseCommand(out, page, request)
 }
 
 // Check for error and panic
@@ -225,27 +378,29 @@ func checkErr(e error) {
 
 // Load config from scalr.conf (supports both flat format and profile-based format)
 func loadConfigScalr(hostname string, token string, account string, profile string) (string, string, string) {
-	home, err := os.UserHomeDir()
-	checkErr(err)
+	configPath := scalrConfigPath()
 
-	home = home + "/.scalr/"
-	config := "scalr.conf"
-
-	content, err := os.ReadFile(home + config)
+	content, err := os.ReadFile(configPath)
 	if err != nil {
 		return hostname, token, account
 	}
 
+	//Report malformed values and unknown keys before anything is read
+	reportConfigIssues(validateScalrConf(configPath, content))
+
 	jsonParsed, err := gabs.ParseJSON(content)
 	checkErr(err)
 
 	// Determine the config source: profile-based or flat (legacy)
 	configSource := jsonParsed
+	source := "legacy flat config (" + configPath + ")"
 
 	if profile != "" {
 		// Explicit profile requested
 		if jsonParsed.Exists(profile) {
 			configSource = jsonParsed.Path(profile)
+			ScalrProfile = profile
+			setConfigSource("profile", "env SCALR_PROFILE")
 		} else {
 			fmt.Fprintf(os.Stderr, "Warning: Profile '%s' not found in scalr.conf, using defaults.\n", profile)
 			return hostname, token, account
@@ -253,19 +408,41 @@ func loadConfigScalr(hostname string, token string, account string, profile stri
 	} else if jsonParsed.Exists("default") && !jsonParsed.Exists("hostname") {
 		// New format detected (has "default" key but no top-level "hostname")
 		configSource = jsonParsed.Path("default")
+		ScalrProfile = "default"
+		setConfigSource("profile", "default profile in "+configPath)
 	}
 	// Otherwise: legacy flat format, configSource stays as jsonParsed
 
-	if configSource.Search("hostname") != nil && hostname == "" {
-		hostname = configSource.Search("hostname").Data().(string)
+	if ScalrProfile != "" {
+		source = "profile '" + ScalrProfile + "' (" + configPath + ")"
+	}
+
+	if value, ok := configSource.Search("hostname").Data().(string); ok && hostname == "" {
+		hostname = value
+		setConfigSource("hostname", source)
 	}
 
-	if configSource.Search("token") != nil && token == "" {
-		token = configSource.Search("token").Data().(string)
+	if value, ok := configSource.Search("token").Data().(string); ok && token == "" {
+		token = value
+		setConfigSource("token", source)
 	}
 
-	if configSource.Search("account") != nil && account == "" {
-		account = configSource.Search("account").Data().(string)
+	if value, ok := configSource.Search("account").Data().(string); ok && account == "" {
+		account = value
+		setConfigSource("account", source)
+	}
+
+	for _, entry := range configSource.Search("protected").Children() {
+		if value, ok := entry.Data().(string); ok {
+			ScalrProtected = append(ScalrProtected, value)
+		}
+	}
+
+	//Warn when a token saved by assume-service-account -save-profile has expired
+	if value, ok := configSource.Search("expires-at").Data().(string); ok {
+		if expiresAt, err := time.Parse(time.RFC3339, value); err == nil && time.Now().After(expiresAt) {
+			fmt.Fprintf(os.Stderr, "Warning: The assumed service account token in %s expired at %s. Run assume-service-account again to refresh it.\n", source, value)
+		}
 	}
 
 	return hostname, token, account
@@ -273,21 +450,23 @@ func loadConfigScalr(hostname string, token string, account string, profile stri
 
 // Load config from credentials.tfrc.json
 func loadConfigTerraform(hostname string, token string) (string, string) {
-	home, err := os.UserHomeDir()
-	checkErr(err)
+	credentialsPath := terraformCredentialsPath()
 
-	content, err := os.ReadFile(home + "/.terraform.d/credentials.tfrc.json")
+	content, err := os.ReadFile(credentialsPath)
 	if err != nil {
 		return hostname, token
 	}
 
+	reportConfigIssues(validateTerraformCredentials(credentialsPath, content))
+
 	jsonParsed, err := gabs.ParseJSON(content)
 	checkErr(err)
 
 	if hostname != "" {
 		//Try to load token for current hostname
-		if jsonParsed.Search("credentials", hostname, "token") != nil {
-			token = jsonParsed.Search("credentials", hostname, "token").Data().(string)
+		if value, ok := jsonParsed.Search("credentials", hostname, "token").Data().(string); ok {
+			token = value
+			setConfigSource("token", "credentials.tfrc.json entry for "+hostname+" ("+credentialsPath+")")
 		}
 	} else {
 		credentials := jsonParsed.Search("credentials").ChildrenMap()
@@ -295,8 +474,10 @@ func loadConfigTerraform(hostname string, token string) (string, string) {
 			//Only exactly one credential entry exists, use it
 			for key, value := range credentials {
 				hostname = key
-				if value.Search("token") != nil {
-					token = value.Search("token").Data().(string)
+				setConfigSource("hostname", "credentials.tfrc.json, only entry ("+credentialsPath+")")
+				if value, ok := value.Search("token").Data().(string); ok {
+					token = value
+					setConfigSource("token", "credentials.tfrc.json, only entry ("+credentialsPath+")")
 				}
 			}
 		}
@@ -307,15 +488,12 @@ func loadConfigTerraform(hostname string, token string) (string, string) {
 
 // Adds token to credentials.tfrc.json and scalr.conf
 func addTerraformToken(hostname string, token string) {
-	home, err := os.UserHomeDir()
-	checkErr(err)
-
-	filePath := home + "/.terraform.d/credentials.tfrc.json"
+	filePath := terraformCredentialsPath()
 
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		// Create directory if it does not exist
-		os.MkdirAll(home+"/.terraform.d/", 0700)
+		os.MkdirAll(filepath.Dir(filePath), 0700)
 
 		content = []byte("{}")
 	}
@@ -328,12 +506,12 @@ func addTerraformToken(hostname string, token string) {
 	err = os.WriteFile(filePath, []byte(jsonParsed.StringIndent("", "  ")), 0600)
 	checkErr(err)
 
-	filePath = home + "/.scalr/scalr.conf"
+	filePath = scalrConfigPath()
 
 	content, err = os.ReadFile(filePath)
 	if err != nil {
 		// Create directory if it does not exist
-		os.MkdirAll(home+"/.scalr/", 0700)
+		os.MkdirAll(filepath.Dir(filePath), 0700)
 
 		content = []byte("{}")
 	}
@@ -348,39 +526,164 @@ func addTerraformToken(hostname string, token string) {
 	checkErr(err)
 }
 
+// Saves an assumed service account token to its own named profile in scalr.conf,
+// leaving the top-level settings and all other profiles untouched.
+func saveAssumedProfile(profile string, hostname string, token string, serviceAccount string, expiresAt time.Time) {
+	checkSaveProfile(profile)
+
+	filePath := scalrConfigPath()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		// Create directory if it does not exist
+		os.MkdirAll(filepath.Dir(filePath), 0700)
+
+		content = []byte("{}")
+	}
+
+	jsonParsed, err := gabs.ParseJSON(content)
+	checkErr(err)
+
+	entry := gabs.New()
+	entry.Set(hostname, "hostname")
+	entry.Set(token, "token")
+	if ScalrAccount != "" {
+		entry.Set(ScalrAccount, "account")
+	}
+	if serviceAccount != "" {
+		entry.Set(serviceAccount, "assumed-service-account")
+	}
+	if !expiresAt.IsZero() {
+		entry.Set(expiresAt.UTC().Format(time.RFC3339), "expires-at")
+	}
+
+	// Replace the whole profile so stale values from a previous assume don't linger
+	jsonParsed.Set(entry.Data(), profile)
+
+	err = os.WriteFile(filePath, []byte(jsonParsed.StringIndent("", "  ")), 0600)
+	checkErr(err)
+
+	fmt.Fprintf(os.Stderr, "Token saved to profile '%s' in %s", profile, filePath)
+	if !expiresAt.IsZero() {
+		fmt.Fprintf(os.Stderr, " (expires %s)", expiresAt.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(os.Stderr, ". Use it with -profile=%s or SCALR_PROFILE=%s.\n", profile, profile)
+}
+
+// Exits if an assumed token must not be saved under this profile name: setting names, the
+// default profile and profiles that hold credentials of the user's own. Called before the
+// token is requested, so nothing is overwritten and no token is thrown away.
+func checkSaveProfile(profile string) {
+	if _, reserved := scalrConfSchema[profile]; reserved {
+		fmt.Fprintf(os.Stderr, "Error: '%s' is a setting name and cannot be used as a profile name\n", profile)
+		os.Exit(ExitError)
+	}
+
+	if profile == "default" {
+		fmt.Fprintln(os.Stderr, "Error: Assumed tokens cannot be saved to the default profile, choose another name for -save-profile")
+		os.Exit(ExitError)
+	}
+
+	content, err := os.ReadFile(scalrConfigPath())
+	if err != nil {
+		return
+	}
+
+	jsonParsed, err := gabs.ParseJSON(content)
+	if err != nil {
+		return
+	}
+
+	// Only profiles written by -save-profile before may be replaced
+	if existing := jsonParsed.Search(profile); existing != nil && !existing.Exists("assumed-service-account") {
+		fmt.Fprintf(os.Stderr, "Error: Profile '%s' already exists and was not saved by assume-service-account, choose another name for -save-profile\n", profile)
+		os.Exit(ExitError)
+	}
+}
+
+// Determines when an assumed token expires. Prefers expiry fields in the response
+// and falls back to the "exp" claim when the token is a JWT.
+// Returns the zero time if the expiry is unknown.
+func assumedTokenExpiry(response *gabs.Container, token string) time.Time {
+	if value, ok := response.Path("expires-at").Data().(string); ok {
+		if expiresAt, err := time.Parse(time.RFC3339, value); err == nil {
+			return expiresAt
+		}
+	}
+
+	if seconds, ok := response.Path("expires-in").Data().(float64); ok {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	claims, err := gabs.ParseJSON(payload)
+	if err != nil {
+		return time.Time{}
+	}
+
+	if exp, ok := claims.Path("exp").Data().(float64); ok {
+		return time.Unix(int64(exp), 0)
+	}
+
+	return time.Time{}
+}
+
 // Loads OpenAPI specification
 func loadAPI() *openapi3.T {
-	cacheDir, err := os.UserCacheDir()
+	loader := newSpecLoader()
+
+	var doc *openapi3.T
+
+	if SpecOverride != "" {
+		// Explicit spec from -spec or SCALR_SPEC, never cached or refreshed
+		doc = loadSpecOverride(loader, SpecOverride)
+	} else if specPinned() {
+		// Spec pinned with 'scalr spec pin', never refreshed
+		var err error
+		doc, err = loader.LoadFromFile(specPinPath())
+		checkErr(err)
+	} else {
+		doc = loadCachedSpec(loader)
+	}
+
+	//Validate the specification
+	err := doc.Validate(loader.Context)
 	checkErr(err)
 
-	cacheDir = cacheDir + "/.scalr/"
+	BasePath = basePathFromSpec(doc)
+
+	return doc
+}
+
+// Loads the spec from the user cache, downloading it when missing or older than 24 hours.
+// Falls back to the spec bundled with the binary when there is no cache and no network.
+func loadCachedSpec(loader *openapi3.Loader) *openapi3.T {
+	cacheDir := specCacheDir()
 
 	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
 		os.MkdirAll(cacheDir, 0700)
 	}
 
-	spec := cacheDir + "cache-openapi-public.yml"
+	spec := specCachePath()
 
-	specURL := "https://" + ScalrHostname + "/api/iacp/v3/openapi-public.yml"
-
-	loader := openapi3.NewLoader()
-	loader.IsExternalRefsAllowed = true
-
-	// Prevent loading external example files which makes the CLI too slow
-	loader.ReadFromURIFunc = disableExternalFiles(
-		openapi3.ReadFromURIs(
-			openapi3.ReadFromHTTP(http.DefaultClient),
-			openapi3.ReadFromFile,
-		),
-	)
+	specURL := specURL()
 
 	var doc *openapi3.T
 
 	if info, err := os.Stat(spec); !os.IsNotExist(err) {
-		if time.Since(info.ModTime()).Hours() > 24 {
+		if specNeedsRefresh(spec, info) {
 			// Cache is more than 24 hours old, re-Download...
 			var dlErr error
-			doc, dlErr = downloadAndValidateSpec(loader, specURL, spec, cacheDir)
+			doc, dlErr = downloadAndValidateSpec(loader, specURL, spec)
 			if dlErr != nil {
 				fmt.Fprintf(os.Stderr, "Warning: Could not refresh API spec: %s. Using cached version.\n", dlErr)
 				doc = nil
@@ -389,10 +692,15 @@ func loadAPI() *openapi3.T {
 	} else {
 		// Download spec
 		var dlErr error
-		doc, dlErr = downloadAndValidateSpec(loader, specURL, spec, cacheDir)
+		doc, dlErr = downloadAndValidateSpec(loader, specURL, spec)
 		if dlErr != nil {
+			if bundled := loadBundledSpec(loader); bundled != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Could not download API specification from %s: %s. Using the specification bundled with this binary, which may be outdated.\n", ScalrHostname, dlErr)
+				return bundled
+			}
+
 			fmt.Fprintf(os.Stderr, "Error: Could not download API specification from %s: %s\n", ScalrHostname, dlErr)
-			fmt.Fprintf(os.Stderr, "Please check your SCALR_HOSTNAME setting and network connection.\n")
+			fmt.Fprintf(os.Stderr, "Please check your SCALR_HOSTNAME setting and network connection, or point -spec / SCALR_SPEC at a local copy.\n")
 			os.Exit(1)
 		}
 	}
@@ -403,25 +711,99 @@ func loadAPI() *openapi3.T {
 		checkErr(err)
 	}
 
-	//Validate the specification
-	err = doc.Validate(loader.Context)
+	return doc
+}
+
+// Reads the base path from the servers section of the specification, if exists
+func basePathFromSpec(doc *openapi3.T) string {
+	if doc.Servers == nil {
+		return ""
+	}
+
+	u := strings.ReplaceAll(doc.Servers[0].URL, "{", "")
+	u = strings.ReplaceAll(u, "}", "")
+
+	parts, err := url.Parse(u)
 	checkErr(err)
 
-	//Read BasePath from servers section, if exists
-	BasePath = ""
-	if doc.Servers != nil {
-		//fmt.Printf("%+#v", doc.Servers[0].URL)
+	return parts.Path
+}
 
-		u := strings.ReplaceAll(doc.Servers[0].URL, "{", "")
-		u = strings.ReplaceAll(u, "}", "")
+// Returns the path of scalr.conf
+func scalrConfigPath() string {
+	home, err := os.UserHomeDir()
+	checkErr(err)
 
-		parts, err := url.Parse(u)
-		checkErr(err)
+	return home + "/.scalr/scalr.conf"
+}
 
-		BasePath = parts.Path
+// Returns the path of Terraform's credentials.tfrc.json
+func terraformCredentialsPath() string {
+	home, err := os.UserHomeDir()
+	checkErr(err)
+
+	return home + "/.terraform.d/credentials.tfrc.json"
+}
+
+// Returns the directory holding the cached OpenAPI specification
+func specCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	checkErr(err)
+
+	return cacheDir + "/.scalr/"
+}
+
+// Returns the path of the cached OpenAPI specification
+func specCachePath() string {
+	return specCacheDir() + "cache-openapi-public." + hostCacheKey() + ".yml"
+}
+
+// Returns the path of the specification pinned with 'scalr spec pin'
+func specPinPath() string {
+	return specCacheDir() + "pinned-openapi-public." + hostCacheKey() + ".yml"
+}
+
+// Returns the hostname in a form safe for file names, so every Scalr installation
+// gets its own cached specification
+func hostCacheKey() string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(ScalrHostname))
+}
+
+// Reports whether a pinned specification is in use instead of the auto-refreshed cache
+func specPinned() bool {
+	if SpecOverride != "" {
+		return false
 	}
 
-	return doc
+	_, err := os.Stat(specPinPath())
+
+	return err == nil
+}
+
+// Returns the URL the OpenAPI specification is downloaded from
+func specURL() string {
+	return "https://" + ScalrHostname + "/api/iacp/v3/openapi-public.yml"
+}
+
+// Creates an OpenAPI loader for the Scalr specification
+func newSpecLoader() *openapi3.Loader {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+
+	// Prevent loading external example files which makes the CLI too slow
+	loader.ReadFromURIFunc = disableExternalFiles(
+		openapi3.ReadFromURIs(
+			openapi3.ReadFromHTTP(http.DefaultClient),
+			openapi3.ReadFromFile,
+		),
+	)
+
+	return loader
 }
 
 func disableExternalFiles(reader openapi3.ReadFromURIFunc) openapi3.ReadFromURIFunc {
@@ -439,17 +821,33 @@ func disableExternalFiles(reader openapi3.ReadFromURIFunc) openapi3.ReadFromURIF
 
 // Downloads the API spec to a temp file, validate it parses, then replaces the cache.
 // Returns the parsed doc so it can be reused without loading from disk again.
-func downloadAndValidateSpec(loader *openapi3.Loader, specURL string, specPath string, cacheDir string) (
+func downloadAndValidateSpec(loader *openapi3.Loader, specURL string, specPath string) (
 	*openapi3.T,
 	error,
 ) {
-	tmpFile := cacheDir + "cache-openapi-public.yml.tmp"
+	tmpFile := specPath + ".tmp"
 
-	if err := downloadFile(specURL, tmpFile); err != nil {
+	// Revalidate the cached copy instead of downloading it again if the server supports it
+	var meta specMeta
+	if _, err := os.Stat(specPath); err == nil {
+		meta = readSpecMeta(specPath)
+	}
+
+	meta, notModified, err := downloadSpec(specURL, tmpFile, meta)
+	if err != nil {
 		os.Remove(tmpFile)
 		return nil, err
 	}
 
+	if notModified {
+		// Unchanged upstream, restart the 24 hour refresh clock. The spec file is left as it
+		// is, so its stamp still matches the command index built from it.
+		meta.CheckedAt = time.Now()
+		writeSpecMeta(specPath, meta)
+
+		return loader.LoadFromFile(specPath)
+	}
+
 	// Validate the downloaded spec can be parsed before replacing the cache
 	doc, err := loader.LoadFromFile(tmpFile)
 	if err != nil {
@@ -462,6 +860,8 @@ func downloadAndValidateSpec(loader *openapi3.Loader, specURL string, specPath s
 		return nil, err
 	}
 
+	writeSpecMeta(specPath, meta)
+
 	return doc, nil
 }
 
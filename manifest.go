@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifest is a declarative list of Scalr resources, as read by `scalr apply`.
+// JSON files are read as well, YAML being a superset of JSON.
+type manifest struct {
+	Resources []manifestResource `yaml:"resources" json:"resources"`
+}
+
+// manifestResource is a single resource of a manifest. Resources are identified by
+// their name (variables by their key) within their scope, never by ID, so the same
+// manifest can be applied to another account.
+type manifestResource struct {
+	Kind          string         `yaml:"kind" json:"kind"`
+	Name          string         `yaml:"name,omitempty" json:"name,omitempty"`
+	Key           string         `yaml:"key,omitempty" json:"key,omitempty"`
+	Attributes    map[string]any `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+	Relationships map[string]any `yaml:"relationships,omitempty" json:"relationships,omitempty"` // names or IDs, a list for to-many relationships
+}
+
+// identity returns the name or key the resource is identified by.
+func (r manifestResource) identity() string {
+	if manifestKinds[r.Kind].Key == "key" {
+		return r.Key
+	}
+
+	return r.Name
+}
+
+// qualifiedName returns the identity of the resource, qualified with its scope for
+// resources whose names are only unique within it, like production/network.
+func (r manifestResource) qualifiedName() string {
+	if scope, ok := nameScopes[r.Kind]; ok {
+		if value, ok := r.Relationships[scope].(string); ok {
+			return value + "/" + r.identity()
+		}
+	}
+
+	return r.identity()
+}
+
+// scoped reports whether one of the scopes of the resource is given, so it does not
+// belong to the account directly.
+func (r manifestResource) scoped() bool {
+	for _, name := range manifestKinds[r.Kind].Scopes {
+		if _, ok := r.Relationships[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r manifestResource) String() string {
+	if manifestKinds[r.Kind].Key != "" {
+		return fmt.Sprintf("%s '%s'", r.Kind, r.identity())
+	}
+
+	//Resources without a name are told apart by what they connect
+	var scopes []string
+	for _, name := range manifestKinds[r.Kind].Scopes {
+		scopes = append(scopes, fmt.Sprintf("%s '%v'", name, r.Relationships[name]))
+	}
+
+	return fmt.Sprintf("%s (%s)", r.Kind, strings.Join(scopes, ", "))
+}
+
+// manifestKind describes a resource type that can be used in a manifest.
+type manifestKind struct {
+	Endpoint      string            // list and create endpoint, {scope} is replaced by the ID of that scope
+	Self          string            // endpoint of a single resource, if it is not below Endpoint
+	Type          string            // JSON:API type
+	Key           string            // attribute identifying the resource, empty if only its scopes do
+	Scopes        []string          // relationships the identifying attribute is unique within
+	ScopeRequired bool              // one of the scopes must be given, all of them if there is no Key
+	AccountScoped bool              // belongs to the account unless one of the scopes is given
+	RelTypes      map[string]string // types of the relationships the specification does not declare
+}
+
+// relationshipType returns the JSON:API type of a relationship, as the create and update
+// commands of the kind declare it in the specification. RelTypes covers relationships the
+// specification does not give a type for. Returns "" if the type is not known.
+func (k manifestKind) relationshipType(index *CommandIndex, name string) string {
+	if relType, ok := k.RelTypes[name]; ok {
+		return relType
+	}
+
+	for _, cmd := range writeCommands(index, k) {
+		for _, f := range cmd.Flags {
+			if f.RelType != "" && strings.HasPrefix(f.Path, "data.relationships."+name+".") {
+				return f.RelType
+			}
+		}
+	}
+
+	return ""
+}
+
+// endpoint returns the list and create endpoint with the IDs of the scopes it contains.
+// Returns false if one of them is missing.
+func (k manifestKind) endpoint(scopeIDs map[string]string) (string, bool) {
+	endpoint := k.Endpoint
+
+	for _, name := range k.Scopes {
+		if strings.Contains(endpoint, "{"+name+"}") {
+			if scopeIDs[name] == "" {
+				return "", false
+			}
+			endpoint = strings.ReplaceAll(endpoint, "{"+name+"}", scopeIDs[name])
+		}
+	}
+
+	return endpoint, true
+}
+
+// inPath reports whether a scope is given by the endpoint rather than a relationship.
+func (k manifestKind) inPath(scope string) bool {
+	return strings.Contains(k.Endpoint, "{"+scope+"}")
+}
+
+// manifestKinds are the resource types a manifest can hold, by kind.
+var manifestKinds = map[string]manifestKind{
+	"environment":            {Endpoint: "/environments", Type: "environments", Key: "name", AccountScoped: true},
+	"workspace":              {Endpoint: "/workspaces", Type: "workspaces", Key: "name", Scopes: []string{"environment"}, ScopeRequired: true},
+	"variable":               {Endpoint: "/vars", Type: "vars", Key: "key", Scopes: []string{"environment", "workspace"}, AccountScoped: true},
+	"tag":                    {Endpoint: "/tags", Type: "tags", Key: "name", AccountScoped: true},
+	"provider-configuration": {Endpoint: "/provider-configurations", Type: "provider-configurations", Key: "name", AccountScoped: true},
+
+	"provider-configuration-link": {Endpoint: "/workspaces/{workspace}/provider-configuration-links", Self: "/provider-configuration-links",
+		Type: "provider-configuration-links", Scopes: []string{"workspace", "provider-configuration"}, ScopeRequired: true},
+	"run-trigger": {Endpoint: "/run-triggers", Type: "run-triggers", Scopes: []string{"downstream", "upstream"}, ScopeRequired: true,
+		RelTypes: map[string]string{"downstream": "workspaces", "upstream": "workspaces"}},
+}
+
+// readManifest reads and checks a manifest file, or stdin if the path is "-".
+func readManifest(path string) ([]manifestResource, error) {
+	var content []byte
+	var err error
+
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed manifest
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	seen := make(map[string]bool)
+
+	for i, r := range parsed.Resources {
+		kind, ok := manifestKinds[r.Kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: resource %d: unknown kind '%s', expected one of: %v", path, i+1, r.Kind, sortedKeys(manifestKinds))
+		}
+
+		if kind.Key != "" && r.identity() == "" {
+			return nil, fmt.Errorf("%s: resource %d: %s needs a %s", path, i+1, r.Kind, kind.Key)
+		}
+
+		scope := ""
+		for _, name := range kind.Scopes {
+			if value, ok := r.Relationships[name].(string); ok {
+				scope += "/" + name + "=" + value
+			}
+		}
+
+		if kind.ScopeRequired && scope == "" {
+			return nil, fmt.Errorf("%s: resource %d: %s needs a %s relationship", path, i+1, r, kind.Scopes[0])
+		}
+
+		for _, name := range kind.Scopes {
+			if _, ok := r.Relationships[name].(string); !ok && kind.Key == "" {
+				return nil, fmt.Errorf("%s: resource %d: %s needs a %s relationship", path, i+1, r.Kind, name)
+			}
+		}
+
+		if seen[r.Kind+"/"+r.identity()+scope] {
+			return nil, fmt.Errorf("%s: resource %d: %s is listed more than once", path, i+1, r)
+		}
+		seen[r.Kind+"/"+r.identity()+scope] = true
+	}
+
+	return parsed.Resources, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nameCacheTTL is how long a resolved name is trusted before it is looked up again.
+// SCALR_NAME_CACHE_TTL overrides it, 0 turns the cache off.
+var nameCacheTTL = time.Hour
+
+const (
+	nameCacheLockWait  = 2 * time.Second  // give up on the cache rather than wait longer for the lock
+	nameCacheLockStale = 10 * time.Second // a lock this old was left behind by a killed process
+)
+
+// nameCacheEntry is a resolved name, as stored in the cache file.
+type nameCacheEntry struct {
+	ID         string    `json:"id"`
+	ResolvedAt time.Time `json:"resolved-at"`
+}
+
+// nameCacheUsed holds the keys of the names this process took from the cache, so they
+// can be forgotten if the API no longer knows their IDs.
+var (
+	nameCacheUsed   []string
+	nameCacheUsedMu sync.Mutex
+)
+
+// Returns the path of the name cache of the current host and account
+func nameCachePath() string {
+	name := "names." + hostCacheKey()
+	if ScalrAccount != "" {
+		name += "." + strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+				return r
+			}
+			return '_'
+		}, strings.ToLower(ScalrAccount))
+	}
+
+	return specCacheDir() + name + ".json"
+}
+
+// cachedName returns the ID a name was resolved to, unless it is unknown or expired.
+func cachedName(key string) (string, bool) {
+	if nameCacheTTL <= 0 {
+		return "", false
+	}
+
+	entry, ok := readNameCache()[key]
+	if !ok || entry.ID == "" || time.Since(entry.ResolvedAt) > nameCacheTTL {
+		return "", false
+	}
+
+	nameCacheUsedMu.Lock()
+	nameCacheUsed = append(nameCacheUsed, key)
+	nameCacheUsedMu.Unlock()
+
+	return entry.ID, true
+}
+
+// cacheName remembers the ID a name was resolved to.
+func cacheName(key string, id string) {
+	if nameCacheTTL <= 0 {
+		return
+	}
+
+	updateNameCache(func(entries map[string]nameCacheEntry) {
+		entries[key] = nameCacheEntry{ID: id, ResolvedAt: time.Now()}
+	})
+}
+
+// forgetUsedNames removes the names this process took from the cache. Called when the
+// API answers 404, as the resource behind one of them may have been deleted or renamed.
+func forgetUsedNames() {
+	nameCacheUsedMu.Lock()
+	used := nameCacheUsed
+	nameCacheUsed = nil
+	nameCacheUsedMu.Unlock()
+
+	if len(used) == 0 {
+		return
+	}
+
+	updateNameCache(func(entries map[string]nameCacheEntry) {
+		for _, key := range used {
+			delete(entries, key)
+		}
+	})
+
+	fmt.Fprintln(os.Stderr, "Note: Cached names used by this request were cleared, they will be looked up again next time.")
+}
+
+// readNameCache reads the name cache. The file is only ever replaced as a whole, so it
+// can be read without the lock. A missing or damaged file is an empty cache.
+func readNameCache() map[string]nameCacheEntry {
+	entries := make(map[string]nameCacheEntry)
+
+	content, err := os.ReadFile(nameCachePath())
+	if err != nil {
+		return entries
+	}
+
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return make(map[string]nameCacheEntry)
+	}
+
+	return entries
+}
+
+// updateNameCache changes the name cache while holding its lock, so changes made by
+// other processes at the same time are not lost. Expired entries are dropped. The cache
+// only saves requests, so if it cannot be locked or written it is left as it is.
+func updateNameCache(change func(entries map[string]nameCacheEntry)) {
+	path := nameCachePath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	unlock, ok := lockNameCache(path)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	entries := readNameCache()
+	change(entries)
+
+	for key, entry := range entries {
+		if time.Since(entry.ResolvedAt) > nameCacheTTL {
+			delete(entries, key)
+		}
+	}
+
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+
+	//Write to a file of our own, then replace the cache in one step
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil || os.Rename(tmpFile.Name(), path) != nil {
+		os.Remove(tmpFile.Name())
+	}
+}
+
+// lockNameCache takes the lock of a cache file, a lock file created exclusively next to it.
+// Returns false if another process holds it for longer than nameCacheLockWait.
+func lockNameCache(path string) (func(), bool) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(nameCacheLockWait)
+
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lock) }, true
+		}
+
+		if !os.IsExist(err) {
+			return nil, false
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > nameCacheLockStale {
+			os.Remove(lock)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runCacheCommand dispatches `scalr cache <subcommand>`.
+func runCacheCommand(args []string) {
+	switch {
+	case len(args) > 0 && args[0] == "clear" && (len(args) == 1 || (len(args) == 2 && args[1] == "-all")):
+		clearNameCache(len(args) == 2)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: scalr cache <subcommand>")
+		fmt.Fprintln(os.Stderr, "  scalr cache clear [-all]   Forget the names resolved for this host and account (or for all of them)")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintf(os.Stderr, "  Resolved names are kept for %s, set SCALR_NAME_CACHE_TTL to change it (0 turns the cache off)\n", nameCacheTTL)
+		os.Exit(ExitError)
+	}
+}
+
+// clearNameCache removes the name cache of the current host and account, or all of them.
+func clearNameCache(all bool) {
+	files := []string{nameCachePath()}
+	if all {
+		files, _ = filepath.Glob(specCacheDir() + "names.*.json")
+	}
+
+	removed := 0
+	for _, file := range files {
+		if err := os.Remove(file); err == nil {
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		fmt.Println("Nothing to clear.")
+		return
+	}
+
+	fmt.Printf("Removed %d name cache file(s) from %s\n", removed, specCacheDir())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNameCache(t *testing.T) {
+	defer withResolvableTypes(t)()
+
+	lookups := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		fmt.Fprint(w, `{"data": [{"id": "env-1", "type": "environments", "attributes": {"name": "production"}}]}`)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	stderr := captureStderr(t, func() {
+		for i := 0; i < 3; i++ {
+			if got := resolveNameToID("environment", "production"); got != "env-1" {
+				t.Errorf("expected 'env-1', got %q", got)
+			}
+		}
+	})
+
+	if lookups != 1 {
+		t.Errorf("expected a single lookup, got %d\n%s", lookups, stderr)
+	}
+
+	//A 404 for a cached ID makes the next call look the name up again
+	captureStderr(t, func() {
+		forgetUsedNames()
+		resolveNameToID("environment", "production")
+	})
+	if lookups != 2 {
+		t.Errorf("expected the name to be looked up again after a 404, got %d lookups", lookups)
+	}
+
+	//Expired entries are not used
+	updateNameCache(func(entries map[string]nameCacheEntry) {
+		entries["environment/production"] = nameCacheEntry{ID: "env-1", ResolvedAt: time.Now().Add(-2 * nameCacheTTL)}
+	})
+	if _, ok := cachedName("environment/production"); ok {
+		t.Error("expired entries must not be used")
+	}
+
+	//Each account has its own cache
+	ScalrAccount = "acc-other"
+	if _, ok := cachedName("environment/production"); ok {
+		t.Error("names must not be shared between accounts")
+	}
+}
+
+func TestNameCache_ConcurrentUpdates(t *testing.T) {
+	defer setHost(t, "https://example.scalr.io")()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cacheName(fmt.Sprintf("workspace/ws%d", i), fmt.Sprintf("ws-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	entries := readNameCache()
+	if len(entries) != 20 {
+		t.Errorf("expected every update to be kept, got %d entries", len(entries))
+	}
+
+	captureStdout(t, func() { clearNameCache(false) })
+	if len(readNameCache()) != 0 {
+		t.Error("expected the cache to be cleared")
+	}
+}
@@ -46,7 +46,7 @@ func openResource(resourceType string, identifier string) {
 	case "workspace", "ws":
 		if identifier == "" {
 			fmt.Fprintln(os.Stderr, "Error: Workspace name or ID required.")
-			fmt.Fprintln(os.Stderr, "Usage: scalr open workspace <name-or-id>")
+			fmt.Fprintln(os.Stderr, "Usage: scalr open workspace <[environment/]name-or-id>")
 			os.Exit(ExitError)
 		}
 		wsID := resolveNameToID("workspace", identifier)
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Jeffail/gabs/v2"
+	"golang.org/x/term"
+)
+
+const pickerVisible = 10 // candidates shown at once, the list scrolls with the selection
+
+// resourcePicked is set once a resource was chosen in the picker, so the command can be
+// echoed with the chosen IDs for use in scripts.
+var resourcePicked bool
+
+// pickerCandidate is a resource offered by the picker.
+type pickerCandidate struct {
+	ID    string
+	Label string // what is shown and searched, like "network  ws-xxx  (environment env-xxx)"
+}
+
+// pickerState is what the picker shows: the search typed so far and the selected match.
+type pickerState struct {
+	candidates []pickerCandidate
+	query      string
+	matches    []pickerCandidate
+	selected   int
+}
+
+// canPick reports whether the picker can be shown, which needs a terminal to read keys
+// from and to draw on. Scripts keep getting an error instead.
+func canPick() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// pickMissing lets the user choose the resource for a required flag that was not given,
+// from the list endpoint of its type. Returns "" if the flag does not name a resource
+// that can be listed, or if there is nothing to choose from.
+func pickMissing(flagName string) string {
+	endpoint, ok := resolvableEndpoint(flagName)
+	if !ok {
+		return ""
+	}
+
+	kind := strings.TrimSuffix(flagName, "-id")
+
+	query := url.Values{}
+	if ScalrAccount != "" && accountFilteredEndpoints[endpoint] {
+		query.Set("filter[account]", ScalrAccount)
+	}
+
+	items := fetchAll(endpoint, query)
+	if len(items) == 0 {
+		return ""
+	}
+
+	return pickResource(kind, items, nameScopes[kind])
+}
+
+// pickResource shows a fuzzy-search picker over API resources on the terminal and returns
+// the ID of the chosen one. Exits if the user cancels.
+func pickResource(kind string, items []*gabs.Container, scope string) string {
+	var candidates []pickerCandidate
+
+	for _, item := range items {
+		id, _ := item.Path("id").Data().(string)
+		name, _ := item.Search("attributes", "name").Data().(string)
+
+		label := id
+		if name != "" {
+			label = name + "  " + id
+		}
+		if scopeID, ok := item.Search("relationships", scope, "data", "id").Data().(string); ok && scope != "" {
+			label += "  (" + scope + " " + scopeID + ")"
+		}
+
+		candidates = append(candidates, pickerCandidate{ID: id, Label: label})
+	}
+
+	id, ok := runPicker(fmt.Sprintf("Select a %s", kind), candidates)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+		os.Exit(ExitError)
+	}
+
+	resourcePicked = true
+
+	return id
+}
+
+// runPicker reads keys from the terminal until a candidate is chosen. Returns false if the
+// picker is cancelled with Esc or Ctrl-C.
+func runPicker(title string, candidates []pickerCandidate) (string, bool) {
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", false
+	}
+	defer term.Restore(int(os.Stdin.Fd()), oldState)
+
+	state := &pickerState{candidates: candidates}
+	state.filter()
+
+	drawn := 0
+	buf := make([]byte, 64)
+
+	for {
+		drawn = state.draw(title, drawn)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", false
+		}
+
+		done, cancelled := state.handleKey(buf[:n])
+		if cancelled {
+			clearLines(drawn)
+			return "", false
+		}
+
+		if done {
+			clearLines(drawn)
+			chosen := state.matches[state.selected]
+			fmt.Fprintf(os.Stderr, "%s: %s\r\n", title, chosen.Label)
+			return chosen.ID, true
+		}
+	}
+}
+
+// handleKey applies a key press read from the terminal. Reports whether a candidate was
+// chosen or the picker was cancelled.
+func (s *pickerState) handleKey(key []byte) (bool, bool) {
+	switch {
+	case len(key) == 1 && (key[0] == 3 || key[0] == 27): // Ctrl-C, Esc
+		return false, true
+	case len(key) == 1 && (key[0] == '\r' || key[0] == '\n'):
+		return len(s.matches) > 0, false
+	case string(key) == "\x1b[A" || string(key) == "\x1bOA" || (len(key) == 1 && key[0] == 16): // Up, Ctrl-P
+		if s.selected > 0 {
+			s.selected--
+		}
+	case string(key) == "\x1b[B" || string(key) == "\x1bOB" || (len(key) == 1 && key[0] == 14): // Down, Ctrl-N
+		if s.selected < len(s.matches)-1 {
+			s.selected++
+		}
+	case len(key) == 1 && (key[0] == 127 || key[0] == 8): // Backspace
+		if s.query != "" {
+			_, size := utf8.DecodeLastRuneInString(s.query)
+			s.query = s.query[:len(s.query)-size]
+			s.filter()
+		}
+	case len(key) == 1 && key[0] == 21: // Ctrl-U
+		s.query = ""
+		s.filter()
+	case len(key) > 0 && key[0] >= 32 && key[0] != 127 && utf8.Valid(key):
+		s.query += string(key)
+		s.filter()
+	}
+
+	return false, false
+}
+
+// filter narrows the candidates down to those matching the search, best matches first.
+func (s *pickerState) filter() {
+	type scored struct {
+		candidate pickerCandidate
+		score     int
+	}
+
+	var matches []scored
+	for _, c := range s.candidates {
+		if score, ok := fuzzyMatch(s.query, c.Label); ok {
+			matches = append(matches, scored{c, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	s.matches = nil
+	for _, m := range matches {
+		s.matches = append(s.matches, m.candidate)
+	}
+
+	s.selected = 0
+}
+
+// draw redraws the picker below the cursor, replacing the lines drawn last time.
+// Returns the number of lines drawn.
+func (s *pickerState) draw(title string, drawn int) int {
+	clearLines(drawn)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (type to search, up/down to move, enter to choose, esc to cancel)\r\n", title)
+	fmt.Fprintf(&b, "> %s\r\n", s.query)
+
+	//Scroll so the selection stays visible
+	start := 0
+	if s.selected >= pickerVisible {
+		start = s.selected - pickerVisible + 1
+	}
+
+	lines := 2
+	for i := start; i < len(s.matches) && i < start+pickerVisible; i++ {
+		marker := "  "
+		if i == s.selected {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%s\r\n", marker, s.matches[i].Label)
+		lines++
+	}
+
+	if len(s.matches) == 0 {
+		b.WriteString("  No matches.\r\n")
+		lines++
+	} else if len(s.matches) > pickerVisible {
+		fmt.Fprintf(&b, "  (%d of %d)\r\n", s.selected+1, len(s.matches))
+		lines++
+	}
+
+	fmt.Fprint(os.Stderr, b.String())
+
+	return lines
+}
+
+// clearLines moves the cursor back up over lines drawn on stderr and erases them.
+func clearLines(lines int) {
+	if lines > 0 {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA\x1b[J", lines)
+	}
+}
+
+// fuzzyMatch reports whether all characters of the query appear in the text in order,
+// ignoring case. Exact substrings score highest, then matches at the start of words and
+// characters that follow each other.
+func fuzzyMatch(query string, text string) (int, bool) {
+	query = strings.ToLower(query)
+	lower := strings.ToLower(text)
+
+	if query == "" {
+		return 0, true
+	}
+
+	if i := strings.Index(lower, query); i >= 0 {
+		score := 1000 - i
+		if i == 0 {
+			score += 1000
+		}
+		return score, true
+	}
+
+	score := 0
+	previous := -2
+	position := 0
+
+	for _, r := range query {
+		i := strings.IndexRune(lower[position:], r)
+		if i < 0 {
+			return 0, false
+		}
+		i += position
+
+		if i == previous+1 {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune(" -_/.", rune(lower[i-1])) {
+			score += 3
+		}
+
+		previous = i
+		position = i + utf8.RuneLen(r)
+	}
+
+	return score, true
+}
+
+// pickedCommand returns the command line the user ran, with the flags as they ended up
+// after resolving names and picking resources, so it can be reused in scripts.
+func pickedCommand(args []string, flags []string) string {
+	quoted := []string{"scalr"}
+
+	for _, arg := range append(args, flags...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes an argument for POSIX shells if it needs it.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=.,:/@%+") == "" {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	state := &pickerState{candidates: []pickerCandidate{
+		{ID: "ws-1", Label: "app-network  ws-1"},
+		{ID: "ws-2", Label: "network  ws-2"},
+		{ID: "ws-3", Label: "net-gateway  ws-3"},
+		{ID: "ws-4", Label: "database  ws-4"},
+	}}
+
+	for _, key := range []string{"n", "e", "t", "w"} {
+		state.handleKey([]byte(key))
+	}
+
+	if len(state.matches) != 3 {
+		t.Fatalf("expected 3 matches for 'netw', got %+v", state.matches)
+	}
+	if state.matches[0].ID != "ws-2" || state.matches[1].ID != "ws-1" {
+		t.Errorf("expected names starting with the search first, then substrings, got %+v", state.matches)
+	}
+
+	if _, ok := fuzzyMatch("nw", "new-work"); !ok {
+		t.Error("characters in order should match")
+	}
+	if _, ok := fuzzyMatch("wn", "new-work"); ok {
+		t.Error("characters out of order must not match")
+	}
+}
+
+func TestPickerKeys(t *testing.T) {
+	state := &pickerState{candidates: []pickerCandidate{{ID: "env-1", Label: "production"}, {ID: "env-2", Label: "staging"}}}
+	state.filter()
+
+	state.handleKey([]byte("\x1b[B"))
+	state.handleKey([]byte("\x1b[B"))
+	if state.selected != 1 {
+		t.Errorf("selection must stop at the last match, got %d", state.selected)
+	}
+
+	state.handleKey([]byte("x"))
+	if len(state.matches) != 0 {
+		t.Errorf("expected no matches, got %+v", state.matches)
+	}
+	if done, _ := state.handleKey([]byte("\r")); done {
+		t.Error("enter must not choose when nothing matches")
+	}
+
+	state.handleKey([]byte{127})
+	if done, _ := state.handleKey([]byte("\r")); !done || state.matches[state.selected].ID != "env-1" {
+		t.Errorf("expected env-1 to be chosen after backspace, got %+v", state)
+	}
+
+	if _, cancelled := state.handleKey([]byte{27}); !cancelled {
+		t.Error("esc must cancel")
+	}
+}
+
+func TestPickedCommand(t *testing.T) {
+	got := pickedCommand([]string{"-format=table", "get-workspace"}, []string{"-workspace=ws-1", "-fields=name,id", "-query=.name == 'x'"})
+	want := `scalr -format=table get-workspace -workspace=ws-1 -fields=name,id '-query=.name == '\''x'\'''`
+
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
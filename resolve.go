@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
@@ -16,25 +17,19 @@ import (
 // "configuration-version-xyz" (multi-word prefix + alphanumeric suffix).
 var scalrIDPattern = regexp.MustCompile(`^[a-z]+(-[a-z]+)*-[a-zA-Z0-9]+$`)
 
-// resolvableResources maps flag names to API list endpoints with name filter support.
-// The value is the path to the list endpoint (relative to BasePath).
-var resolvableResources = map[string]string{
-	"workspace":      "/workspaces",
-	"workspace-id":   "/workspaces",
-	"environment":    "/environments",
-	"environment-id": "/environments",
-	"account":        "/accounts",
-	"account-id":     "/accounts",
-	"tag":            "/tags",
-	"tag-id":         "/tags",
-	"role":           "/roles",
-	"role-id":        "/roles",
-	"team":           "/teams",
-	"team-id":        "/teams",
-	"vcs-provider":    "/vcs-providers",
-	"vcs-provider-id": "/vcs-providers",
-	"agent-pool":      "/agent-pools",
-	"agent-pool-id":   "/agent-pools",
+// ResolvableTypes maps JSON:API types to their list endpoints with name filter support,
+// as found in the spec by the command index.
+var ResolvableTypes map[string]string
+
+// accountFilteredEndpoints are the list endpoints that are filtered by the current account.
+var accountFilteredEndpoints = map[string]bool{
+	"/workspaces":              true,
+	"/environments":            true,
+	"/tags":                    true,
+	"/roles":                   true,
+	"/teams":                   true,
+	"/vars":                    true,
+	"/provider-configurations": true,
 }
 
 // isScalrID checks if a value looks like a Scalr resource ID.
@@ -42,95 +37,346 @@ func isScalrID(value string) bool {
 	return scalrIDPattern.MatchString(value)
 }
 
+// nameScopes maps resources whose names are only unique within another resource to
+// that resource. Their names can be qualified with it, like prod/network for a workspace.
+var nameScopes = map[string]string{
+	"workspace": "environment",
+}
+
 // resolveNameToID attempts to resolve a human-readable name to a Scalr resource ID.
-// If the value already looks like an ID, it is returned unchanged.
+// If the value already looks like an ID, it is returned unchanged. Names of workspaces
+// can be qualified with the name or ID of their environment, like prod/network.
 // If resolution fails or matches multiple resources, an error is printed and the program exits.
 func resolveNameToID(flagName string, value string) string {
 	if value == "" || isScalrID(value) {
 		return value
 	}
 
-	endpoint, ok := resolvableResources[flagName]
+	endpoint, ok := resolvableEndpoint(flagName)
 	if !ok {
 		// Not a resolvable resource — return as-is (might be a legitimate string value)
 		return value
 	}
 
-	// Query the list endpoint with a name filter
+	kind := strings.TrimSuffix(flagName, "-id")
+	name := value
+
+	if id, ok := cachedName(kind + "/" + value); ok {
+		fmt.Fprintf(os.Stderr, "Resolved %s '%s' -> %s (cached)\n", flagName, value, id)
+		return id
+	}
+
+	// Query the list endpoint with a name filter. The filter also matches names that only
+	// contain the given one, so every page is read to find the exact match.
 	params := url.Values{}
-	params.Set("filter[name]", value)
-	params.Set("page[size]", "10")
 
+	// A qualified name is looked up within its scope, which is resolved first
+	scope, scoped := nameScopes[kind]
+	if scopeName, rest, found := strings.Cut(value, "/"); scoped && found {
+		params.Set("filter["+scope+"]", resolveNameToID(scope, scopeName))
+		name = rest
+	}
+
+	params.Set("filter[name]", name)
+
+	items, ok := lookupResources(endpoint, params)
+	if !ok {
+		// Resolution failed — return original and let the main request handle errors
+		return value
+	}
+
+	// The server also matches names that only contain the given one, so compare exactly
+	var matches []*gabs.Container
+	for _, item := range items {
+		if itemName, _ := item.Search("attributes", "name").Data().(string); itemName == name {
+			matches = append(matches, item)
+		}
+	}
+
+	//On a terminal, the user chooses among the similar names or the ones that match
+	if len(matches) == 0 && len(items) > 0 && canPick() {
+		fmt.Fprintf(os.Stderr, "No %s is named exactly '%s'.\n", kind, value)
+		return pickResource(kind, items, scope)
+	}
+
+	if len(matches) > 1 && canPick() {
+		fmt.Fprintf(os.Stderr, "Multiple %s resources match name '%s'.\n", kind, value)
+		return pickResource(kind, matches, scope)
+	}
+
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No %s found with name '%s'\n", kind, value)
+		if len(items) > 0 {
+			fmt.Fprintln(os.Stderr, "Similar names:")
+			printResolveCandidates(items, scope)
+		}
+		os.Exit(ExitError)
+	}
+
+	if len(matches) == 1 {
+		id := matches[0].Path("id").Data().(string)
+		fmt.Fprintf(os.Stderr, "Resolved %s '%s' -> %s\n", flagName, value, id)
+		cacheName(kind+"/"+value, id)
+		return id
+	}
+
+	// Multiple matches
+	fmt.Fprintf(os.Stderr, "Error: Multiple %s resources match name '%s':\n", kind, value)
+	printResolveCandidates(matches, scope)
+	if scoped {
+		fmt.Fprintf(os.Stderr, "Please specify the exact ID, or qualify the name with its %s like <%s>/%s.\n", scope, scope, name)
+	} else {
+		fmt.Fprintln(os.Stderr, "Please specify the exact ID.")
+	}
+	os.Exit(ExitError)
+	return value // unreachable
+}
+
+// printResolveCandidates lists resources that a name could refer to, with their scope if any.
+func printResolveCandidates(items []*gabs.Container, scope string) {
+	for _, item := range items {
+		id, _ := item.Path("id").Data().(string)
+		name, _ := item.Search("attributes", "name").Data().(string)
+
+		if scopeID, ok := item.Search("relationships", scope, "data", "id").Data().(string); ok && scope != "" {
+			fmt.Fprintf(os.Stderr, "  %s  %s  (%s %s)\n", id, name, scope, scopeID)
+		} else {
+			fmt.Fprintf(os.Stderr, "  %s  %s\n", id, name)
+		}
+	}
+}
+
+// resolvableEndpoint returns the list endpoint the names given to a flag are looked up in,
+// as found in the spec for its type. Returns false if the spec offers none.
+func resolvableEndpoint(flagName string) (string, bool) {
+	base := strings.TrimSuffix(flagName, "-id")
+
+	for _, relType := range []string{base + "s", base} {
+		if endpoint, ok := ResolvableTypes[relType]; ok {
+			return endpoint, true
+		}
+	}
+
+	return "", false
+}
+
+// resolveTypedName resolves a name to the ID of a resource of the given JSON:API type.
+func resolveTypedName(relType string, value string) string {
+	return resolveNameToID(strings.TrimSuffix(relType, "s"), value)
+}
+
+// resolveRelationshipNames resolves the names given to a relationship flag, such as
+// -environment-id, or each of them for lists like -tags-id=prod,core.
+func resolveRelationshipNames(f *IndexFlag, value string) string {
+	items := []string{value}
+	if f.RelArray {
+		items = strings.Split(value, ",")
+	}
+
+	for i, item := range items {
+		items[i] = resolveTypedName(f.RelType, strings.TrimSpace(item))
+	}
+
+	return strings.Join(items, ",")
+}
+
+// hasNames reports whether a flag value holds names that would be resolved to IDs, which
+// dry runs show as given instead of looking them up.
+func hasNames(f *IndexFlag, value string) bool {
+	flagName := f.Name
+	items := []string{value}
+
+	if f.Location != "path" && f.Location != "query" {
+		if f.RelType == "" {
+			return false
+		}
+		flagName = strings.TrimSuffix(f.RelType, "s")
+		if f.RelArray {
+			items = strings.Split(value, ",")
+		}
+	}
+
+	if _, ok := resolvableEndpoint(flagName); !ok {
+		return false
+	}
+
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" && !isScalrID(item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupResources queries a list endpoint with the given filters, scoped to the current
+// account for the resources that belong to one. Every page is read, so a match is not
+// missed in large accounts. Returns false if the lookup failed.
+func lookupResources(endpoint string, params url.Values) ([]*gabs.Container, bool) {
 	// For workspaces and some resources, also need account filter
-	if ScalrAccount != "" && (strings.Contains(endpoint, "/workspaces") ||
-		strings.Contains(endpoint, "/environments") ||
-		strings.Contains(endpoint, "/tags") ||
-		strings.Contains(endpoint, "/roles") ||
-		strings.Contains(endpoint, "/teams")) {
+	if ScalrAccount != "" && accountFilteredEndpoints[endpoint] {
 		params.Set("filter[account]", ScalrAccount)
 	}
 
+	params.Set("page[size]", "100")
+
+	var items []*gabs.Container
+
+	for page := 1; ; page++ {
+		params.Set("page[number]", strconv.Itoa(page))
+
+		response, ok := lookupPage(endpoint, params)
+		if !ok {
+			return nil, false
+		}
+
+		items = append(items, response.Path("data").Children()...)
+
+		if response.Path("meta.pagination.next-page").Data() == nil {
+			return items, true
+		}
+	}
+}
+
+// lookupPage reads one page of a lookup. Returns false if the request failed.
+func lookupPage(endpoint string, params url.Values) (*gabs.Container, bool) {
 	apiURL := "https://" + ScalrHostname + BasePath + endpoint + "?" + params.Encode()
 
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
-		// Can't resolve — return original value and let the API handle it
-		return value
+		return nil, false
 	}
 
 	setScalrHeaders(req)
 
 	res, err := scalrHTTPClient.Do(req)
 	if err != nil {
-		return value
+		return nil, false
 	}
 
 	defer res.Body.Close()
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
-		return value
+		return nil, false
 	}
 
 	if res.StatusCode >= 300 {
-		// Resolution failed — return original and let the main request handle errors
-		return value
+		return nil, false
 	}
 
 	response, err := gabs.ParseJSON(resBody)
 	if err != nil {
-		return value
+		return nil, false
 	}
 
-	items := response.Path("data").Children()
+	return response, true
+}
 
-	if len(items) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: No %s found with name '%s'\n", strings.TrimSuffix(flagName, "-id"), value)
-		os.Exit(ExitError)
+// relationshipNames holds the names of related resources looked up for -resolve-names
+// during this run, by ID. IDs that could not be looked up map to "".
+var relationshipNames = make(map[string]string)
+
+// fieldIncludes returns the relationships among the fields of -fields that the API can include,
+// as given by the values of the include parameter. Without -fields nothing is included, the
+// related resources are then looked up by resolveRelationshipLabels.
+func fieldIncludes(includable []string, fields string) []string {
+	var include []string
+
+	for _, field := range strings.Split(fields, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(field), ".")
+		if containsString(includable, name) && !containsString(include, name) {
+			include = append(include, name)
+		}
 	}
 
-	if len(items) == 1 {
-		id := items[0].Path("id").Data().(string)
-		name := ""
-		if items[0].Exists("attributes", "name") {
-			name = items[0].Path("attributes.name").Data().(string)
+	return include
+}
+
+// resolveRelationshipLabels adds the names of related resources to the relationship objects
+// of output items. Resources the API included in the response, for -include or the fields of
+// -fields, already have theirs. The others are looked up with one list call per type, filtered
+// by their IDs.
+func resolveRelationshipLabels(items []*gabs.Container) {
+	var refs []map[string]any
+	missing := make(map[string][]string) // IDs to look up, by type
+
+	for _, item := range items {
+		for _, value := range item.ChildrenMap() {
+			for _, ref := range relationshipRefs(value.Data()) {
+				id, _ := unwrapGabs(ref["id"]).(string)
+				relType, _ := unwrapGabs(ref["type"]).(string)
+
+				if _, named := ref["name"]; named || id == "" || relType == "" {
+					continue
+				}
+
+				refs = append(refs, ref)
+
+				if _, known := relationshipNames[id]; !known && !containsString(missing[relType], id) {
+					missing[relType] = append(missing[relType], id)
+				}
+			}
 		}
-		if name != "" {
-			fmt.Fprintf(os.Stderr, "Resolved %s '%s' -> %s\n", flagName, value, id)
+	}
+
+	for relType, ids := range missing {
+		lookupRelationshipNames(relType, ids)
+	}
+
+	for _, ref := range refs {
+		id, _ := unwrapGabs(ref["id"]).(string)
+		if name := relationshipNames[id]; name != "" {
+			ref["name"] = name
 		}
-		return id
 	}
+}
 
-	// Multiple matches
-	fmt.Fprintf(os.Stderr, "Error: Multiple %s resources match name '%s':\n", strings.TrimSuffix(flagName, "-id"), value)
-	for _, item := range items {
-		id := item.Path("id").Data().(string)
-		name := ""
-		if item.Exists("attributes", "name") {
-			name = item.Path("attributes.name").Data().(string)
+// relationshipRefs returns the related resources in an output value: a single relationship
+// object or a list of them.
+func relationshipRefs(value any) []map[string]any {
+	var refs []map[string]any
+
+	switch v := unwrapGabs(value).(type) {
+	case map[string]any:
+		if _, ok := v["id"]; ok && v["type"] != nil {
+			refs = append(refs, v)
+		}
+	case []any:
+		for _, item := range v {
+			refs = append(refs, relationshipRefs(item)...)
+		}
+	}
+
+	return refs
+}
+
+// lookupRelationshipNames fetches the names of resources of one type by their IDs, a page
+// of them per request. Users and others without a name are known by their email or key.
+func lookupRelationshipNames(relType string, ids []string) {
+	if endpoint, ok := resolvableEndpoint(strings.TrimSuffix(relType, "s")); ok {
+		for start := 0; start < len(ids); start += 100 {
+			params := url.Values{}
+			params.Set("filter[id]", "in:"+strings.Join(ids[start:min(start+100, len(ids))], ","))
+			params.Set("page[size]", "100")
+
+			items, _ := lookupResources(endpoint, params)
+
+			for _, item := range items {
+				id, _ := item.Path("id").Data().(string)
+
+				for _, attribute := range []string{"name", "email", "key"} {
+					if name, ok := item.Search("attributes", attribute).Data().(string); ok && name != "" {
+						relationshipNames[id] = name
+						break
+					}
+				}
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if _, ok := relationshipNames[id]; !ok {
+			relationshipNames[id] = ""
 		}
-		fmt.Fprintf(os.Stderr, "  %s  %s\n", id, name)
 	}
-	fmt.Fprintln(os.Stderr, "Please specify the exact ID.")
-	os.Exit(ExitError)
-	return value // unreachable
 }
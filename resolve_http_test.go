@@ -18,6 +18,10 @@ func setHost(t *testing.T, serverURL string) func() {
 		t.Fatalf("bad server URL: %v", err)
 	}
 
+	// Keep resolved names out of the user's cache
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
 	oldHost := ScalrHostname
 	oldBase := BasePath
 	oldToken := ScalrToken
@@ -61,7 +65,7 @@ func TestResolveNameToID_AlreadyAnID(t *testing.T) {
 }
 
 func TestResolveNameToID_UnknownFlagName(t *testing.T) {
-	// Flag name is not in resolvableResources — should return as-is
+	// Flag name is not resolvable in the spec — should return as-is
 	got := resolveNameToID("some-random-flag", "not-an-id-value")
 	if got != "not-an-id-value" {
 		t.Errorf("unknown flag should pass through, got %q", got)
@@ -76,6 +80,8 @@ func TestResolveNameToID_EmptyValue(t *testing.T) {
 }
 
 func TestResolveNameToID_SingleMatch(t *testing.T) {
+	defer withResolvableTypes(t)()
+
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Verify filter[name] was URL-encoded
 		name := r.URL.Query().Get("filter[name]")
@@ -100,7 +106,36 @@ func TestResolveNameToID_SingleMatch(t *testing.T) {
 	})
 }
 
+func TestResolveNameToID_ExactMatchOnLaterPage(t *testing.T) {
+	defer withResolvableTypes(t)()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		//The server filter matches by substring, the exact name only comes on the second page
+		if r.URL.Query().Get("page[number]") == "1" {
+			fmt.Fprint(w, `{"data": [{"id": "env-1", "type": "environments", "attributes": {"name": "production-eu"}}],
+				"meta": {"pagination": {"next-page": 2}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "env-2", "type": "environments", "attributes": {"name": "production"}}],
+			"meta": {"pagination": {"next-page": null}}}`)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	captureStderr(t, func() {
+		if got := resolveNameToID("environment", "production"); got != "env-2" {
+			t.Errorf("expected 'env-2' from the second page, got %q", got)
+		}
+	})
+}
+
 func TestResolveNameToID_URLEncodesSpecialChars(t *testing.T) {
+	defer withResolvableTypes(t)()
+
 	// Verifies the URL encoding fix: values with & or = must not break the query
 	var rawURL string
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -123,3 +158,159 @@ func TestResolveNameToID_URLEncodesSpecialChars(t *testing.T) {
 		t.Errorf("value should be URL-encoded, got raw query: %s", rawURL)
 	}
 }
+
+func TestResolveNameToID_QualifiedName(t *testing.T) {
+	defer withResolvableTypes(t)()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		// The server's name filter also returns names that only contain the value
+		switch r.URL.Path {
+		case "/environments":
+			fmt.Fprint(w, `{"data": [
+				{"id": "env-1", "type": "environments", "attributes": {"name": "prod"}},
+				{"id": "env-2", "type": "environments", "attributes": {"name": "prod-old"}}
+			]}`)
+		case "/workspaces":
+			if env := r.URL.Query().Get("filter[environment]"); env != "env-1" {
+				t.Errorf("expected the lookup to be scoped to env-1, got %q", env)
+			}
+			fmt.Fprint(w, `{"data": [
+				{"id": "ws-2", "type": "workspaces", "attributes": {"name": "network-v2"}},
+				{"id": "ws-1", "type": "workspaces", "attributes": {"name": "network"}}
+			]}`)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	captureStderr(t, func() {
+		if got := resolveNameToID("workspace", "prod/network"); got != "ws-1" {
+			t.Errorf("expected 'ws-1', got %q", got)
+		}
+
+		if got := resolveNameToID("workspace-id", "env-1/network"); got != "ws-1" {
+			t.Errorf("expected 'ws-1' for an environment ID, got %q", got)
+		}
+	})
+}
+
+func TestResolveRelationshipNames(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/labels" {
+			t.Errorf("expected lookup in the list endpoint from the spec, got %s", r.URL.Path)
+		}
+
+		name := r.URL.Query().Get("filter[name]")
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		fmt.Fprintf(w, `{"data": [{"id": "label-%s", "type": "labels", "attributes": {"name": %q}}]}`, name, name)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	oldTypes := ResolvableTypes
+	ResolvableTypes = map[string]string{"labels": "/labels"}
+	defer func() { ResolvableTypes = oldTypes }()
+
+	captureStderr(t, func() {
+		list := &IndexFlag{Name: "labels-id", RelType: "labels", RelArray: true}
+		if got := resolveRelationshipNames(list, "prod,label-abc123,core"); got != "label-prod,label-abc123,label-core" {
+			t.Errorf("unexpected list: %q", got)
+		}
+
+		single := &IndexFlag{Name: "label-id", RelType: "labels"}
+		if got := resolveRelationshipNames(single, "prod"); got != "label-prod" {
+			t.Errorf("unexpected ID: %q", got)
+		}
+
+		other := &IndexFlag{Name: "color-id", RelType: "colors"}
+		if got := resolveRelationshipNames(other, "blue"); got != "blue" {
+			t.Errorf("types without a name filter must pass through, got %q", got)
+		}
+	})
+}
+
+func TestResolveRelationshipLabels(t *testing.T) {
+	defer withResolvableTypes(t)()
+
+	lookups := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+
+		if r.URL.Path != "/environments" || r.URL.Query().Get("filter[id]") != "in:env-1,env-2" {
+			t.Errorf("expected one lookup of both environments, got %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		fmt.Fprint(w, `{"data": [
+			{"id": "env-1", "type": "environments", "attributes": {"name": "production"}},
+			{"id": "env-2", "type": "environments", "attributes": {"name": "staging"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	items := parseJSONForTest(t, `[
+		{"id": "ws-1", "environment": {"id": "env-1", "type": "environments"}},
+		{"id": "ws-2", "environment": {"id": "env-2", "type": "environments"}},
+		{"id": "ws-3", "environment": {"id": "env-1", "type": "environments"},
+		 "agent-pool": {"id": "apool-1", "type": "agent-pools", "name": "included"}}
+	]`).Children()
+
+	resolveRelationshipLabels(items)
+
+	//Names are kept for the rest of the run
+	later := parseJSONForTest(t, `[{"id": "ws-4", "environment": {"id": "env-2", "type": "environments"}}]`).Children()
+	resolveRelationshipLabels(later)
+
+	if got := later[0].Search("environment", "name").Data(); got != "staging" {
+		t.Errorf("expected the name from the first lookup, got %v", got)
+	}
+
+	if lookups != 1 {
+		t.Errorf("expected names to be looked up once for the run, got %d lookups", lookups)
+	}
+
+	for i, want := range []string{"production", "staging", "production"} {
+		if got := items[i].Search("environment", "name").Data(); got != want {
+			t.Errorf("item %d: expected %q, got %v", i, want, got)
+		}
+	}
+}
+
+func TestLookupResources_Paginates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch r.URL.Query().Get("page[number]") {
+		case "1":
+			fmt.Fprint(w, `{"data": [{"id": "env-1", "type": "environments", "attributes": {"name": "production-old"}}],
+				"meta": {"pagination": {"current-page": 1, "next-page": 2}}}`)
+		case "2":
+			fmt.Fprint(w, `{"data": [{"id": "env-2", "type": "environments", "attributes": {"name": "production"}}],
+				"meta": {"pagination": {"current-page": 2, "next-page": null}}}`)
+		default:
+			t.Errorf("unexpected page %s", r.URL.RawQuery)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	items, ok := lookupResources("/environments", url.Values{"filter[name]": {"production"}})
+	if !ok || len(items) != 2 {
+		t.Fatalf("expected the items of both pages, got %d (ok=%v)", len(items), ok)
+	}
+	if id, _ := items[1].Path("id").Data().(string); id != "env-2" {
+		t.Errorf("expected env-2 from the second page, got %q", id)
+	}
+}
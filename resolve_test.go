@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestIsScalrID(t *testing.T) {
 	tests := []struct {
@@ -65,3 +68,48 @@ func TestIsScalrID_EdgeCases(t *testing.T) {
 		t.Error("empty string should not match")
 	}
 }
+
+func TestHasNames(t *testing.T) {
+	oldTypes := ResolvableTypes
+	ResolvableTypes = map[string]string{"labels": "/labels", "environments": "/environments"}
+	defer func() { ResolvableTypes = oldTypes }()
+
+	tests := []struct {
+		flag  IndexFlag
+		value string
+		want  bool
+	}{
+		{IndexFlag{Name: "environment", Location: "path"}, "production", true},
+		{IndexFlag{Name: "environment", Location: "path"}, "env-v0ord9ss8pbn1ql34", false},
+		{IndexFlag{Name: "color", Location: "query"}, "blue", false},
+		{IndexFlag{Name: "labels-id", RelType: "labels", RelArray: true}, "label-abc123,core", true},
+		{IndexFlag{Name: "labels-id", RelType: "labels", RelArray: true}, "label-abc123", false},
+		{IndexFlag{Name: "name"}, "production", false},
+	}
+
+	for _, tt := range tests {
+		if got := hasNames(&tt.flag, tt.value); got != tt.want {
+			t.Errorf("%s=%s: expected %v, got %v", tt.flag.Name, tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestFieldIncludes(t *testing.T) {
+	includable := []string{"environment", "tags", "created-by"}
+
+	tests := []struct {
+		fields string
+		want   []string
+	}{
+		{"", nil},
+		{"id,name", nil},
+		{"id,name,environment", []string{"environment"}},
+		{"environment.name, tags,environment", []string{"environment", "tags"}},
+	}
+
+	for _, tt := range tests {
+		if got := fieldIncludes(includable, tt.fields); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.fields, tt.want, got)
+		}
+	}
+}
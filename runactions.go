@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// runGate continues runs that wait for a human, as far as the -on-planned, -on-policy-soft-fail
+// and -on-cost-estimated policies of wait-for-run allow.
+type runGate struct {
+	opts    WaitOptions
+	handled map[string]bool // statuses an action was taken in, so it is taken only once
+}
+
+func newRunGate(opts WaitOptions) *runGate {
+	return &runGate{opts: opts, handled: make(map[string]bool)}
+}
+
+// validateWaitPolicies checks the policies for blocked runs. Every action taken on a run
+// is recorded with a comment, so one is required as soon as a policy may act.
+func validateWaitPolicies(opts *WaitOptions, onCostEstimated string) error {
+	switch opts.OnPlanned {
+	case "", "fail", "apply", "discard":
+	default:
+		return fmt.Errorf("invalid -on-planned '%s', expected apply, discard or fail", opts.OnPlanned)
+	}
+
+	switch opts.OnPolicySoftFail {
+	case "", "fail", "override":
+	default:
+		return fmt.Errorf("invalid -on-policy-soft-fail '%s', expected override or fail", opts.OnPolicySoftFail)
+	}
+
+	if limit, ok := strings.CutPrefix(onCostEstimated, "approve-below="); ok {
+		amount, err := strconv.ParseFloat(limit, 64)
+		if err != nil || amount <= 0 {
+			return fmt.Errorf("invalid -on-cost-estimated '%s', expected approve-below=<amount> with an amount above 0", onCostEstimated)
+		}
+		opts.ApproveBelow = amount
+	} else if onCostEstimated != "" && onCostEstimated != "fail" {
+		return fmt.Errorf("invalid -on-cost-estimated '%s', expected approve-below=<amount> or fail", onCostEstimated)
+	}
+
+	acts := opts.OnPlanned == "apply" || opts.OnPlanned == "discard" || opts.OnPolicySoftFail == "override" || opts.ApproveBelow > 0
+	if acts && strings.TrimSpace(opts.Comment) == "" {
+		return fmt.Errorf("-comment is required when -on-planned, -on-policy-soft-fail or -on-cost-estimated act on a run")
+	}
+
+	return nil
+}
+
+// handle is called when waiting for a run would end because the run is blocked. Returns true
+// if the run was continued and should be polled further, and a note on what was done.
+func (g *runGate) handle(runID string, status string, outcome string, runData *gabs.Container) (bool, string) {
+	if outcome != outcomeBlocked && outcome != outcomeConfirmation {
+		return false, ""
+	}
+
+	// The action was taken, the run has not moved on yet
+	if g.handled[status] {
+		return true, ""
+	}
+
+	switch {
+	case outcome == outcomeConfirmation:
+		return g.confirm(runID, status, g.opts.OnPlanned)
+
+	case status == "policy_checked" && g.opts.OnPolicySoftFail == "override":
+		return g.override(runID, status, runData)
+
+	// After the override, the run goes on as a planned one would
+	case status == "policy_override" && g.handled["policy_checked"]:
+		if autoApply, ok := runData.Path("auto-apply").Data().(bool); !ok || autoApply {
+			return true, ""
+		}
+		return g.confirm(runID, status, g.opts.OnPlanned)
+
+	case status == "cost_estimated" && g.opts.ApproveBelow > 0:
+		return g.approveCost(runID, status, runData)
+	}
+
+	return false, ""
+}
+
+// confirm applies or discards a run, as the policy says.
+func (g *runGate) confirm(runID string, status string, policy string) (bool, string) {
+	if policy != "apply" && policy != "discard" {
+		return false, ""
+	}
+
+	if err := g.act("/runs/"+runID+"/actions/"+policy, false); err != nil {
+		return false, fmt.Sprintf("Could not %s run %s: %s", policy, runID, err)
+	}
+
+	g.handled[status] = true
+
+	if policy == "discard" {
+		return true, fmt.Sprintf("Discarded run %s (-on-planned=discard)", runID)
+	}
+	return true, fmt.Sprintf("Confirmed run %s to apply (-on-planned=apply)", runID)
+}
+
+// override overrides the soft-mandatory policy checks of a run that failed.
+func (g *runGate) override(runID string, status string, runData *gabs.Container) (bool, string) {
+	related, _ := unwrapGabs(runData.Path("policy-checks").Data()).([]any)
+
+	overridden := 0
+	for _, check := range related {
+		check, _ := unwrapGabs(check).(map[string]any)
+		checkID, _ := unwrapGabs(check["id"]).(string)
+		if checkID == "" {
+			continue
+		}
+
+		policyCheck, err := runRequest("GET", "/policy-checks/"+checkID, nil)
+		if err != nil {
+			return false, fmt.Sprintf("Could not read policy check %s: %s", checkID, err)
+		}
+		if policyCheck.Path("data.attributes.status").Data() != "soft_failed" {
+			continue
+		}
+
+		if err := g.act("/policy-checks/"+checkID+"/actions/override", true); err != nil {
+			return false, fmt.Sprintf("Could not override policy check %s: %s", checkID, err)
+		}
+		overridden++
+	}
+
+	if overridden == 0 {
+		return false, fmt.Sprintf("Run %s has no soft-failed policy check to override", runID)
+	}
+
+	g.handled[status] = true
+
+	return true, fmt.Sprintf("Overrode %d soft-failed policy check(s) of run %s (-on-policy-soft-fail=override)", overridden, runID)
+}
+
+// approveCost confirms a run whose estimated monthly cost is below the -on-cost-estimated limit.
+func (g *runGate) approveCost(runID string, status string, runData *gabs.Container) (bool, string) {
+	estimateID := relatedID(runData, "cost-estimate")
+	if estimateID == "" {
+		return false, fmt.Sprintf("Run %s has no cost estimate", runID)
+	}
+
+	estimate, err := runRequest("GET", "/cost-estimates/"+estimateID, nil)
+	if err != nil {
+		return false, fmt.Sprintf("Could not read cost estimate %s: %s", estimateID, err)
+	}
+
+	cost, ok := costAmount(estimate.Path("data.attributes.proposed-monthly-cost").Data())
+	if !ok {
+		return false, fmt.Sprintf("Cost estimate %s of run %s has no proposed monthly cost", estimateID, runID)
+	}
+
+	limit := strconv.FormatFloat(g.opts.ApproveBelow, 'f', -1, 64)
+	if cost >= g.opts.ApproveBelow {
+		return false, fmt.Sprintf("Estimated monthly cost %s of run %s is not below %s", strconv.FormatFloat(cost, 'f', 2, 64), runID, limit)
+	}
+
+	if err := g.act("/runs/"+runID+"/actions/apply", false); err != nil {
+		return false, fmt.Sprintf("Could not approve run %s: %s", runID, err)
+	}
+
+	g.handled[status] = true
+
+	return true, fmt.Sprintf("Approved run %s, estimated monthly cost %s is below %s (-on-cost-estimated)", runID, strconv.FormatFloat(cost, 'f', 2, 64), limit)
+}
+
+// act takes an action on a run or one of its checks, with the comment of -comment.
+func (g *runGate) act(endpoint string, jsonAPI bool) error {
+	body := map[string]any{"comment": g.opts.Comment}
+	if jsonAPI {
+		body = map[string]any{"data": map[string]any{"attributes": body}}
+	}
+
+	content, err := json.Marshal(body)
+	checkErr(err)
+
+	_, err = runRequest("POST", endpoint, content)
+	return err
+}
+
+// costAmount reads a cost from a cost estimate, which may be given as a number or a string.
+func costAmount(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		amount, err := strconv.ParseFloat(v, 64)
+		return amount, err == nil
+	}
+	return 0, false
+}
+
+// runRequest sends a request for wait-for-run. Unlike sendJSON it returns errors instead of
+// exiting, so one run can fail without ending the wait for the others. Only reads are retried,
+// actions are sent once, as a retry could apply or discard a run twice.
+func runRequest(method string, apiPath string, body []byte) (*gabs.Container, error) {
+	req, err := http.NewRequest(method, "https://"+ScalrHostname+BasePath+apiPath, bytes.NewReader(body))
+	checkErr(err)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.api+json")
+	}
+
+	setScalrHeaders(req)
+
+	var res *http.Response
+	if method == "GET" {
+		res, err = doWithRetry(req)
+	} else {
+		res, err = scalrHTTPClient.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %d: %s", res.StatusCode, apiErrorMessage(resBody))
+	}
+
+	if len(bytes.TrimSpace(resBody)) == 0 {
+		return gabs.New(), nil
+	}
+
+	return gabs.ParseJSON(resBody)
+}
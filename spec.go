@@ -0,0 +1,173 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// bundledSpecFS holds the OpenAPI specification embedded at build time.
+// Releases embed the reviewed copy committed to spec/, which `make build` and
+// build-all.sh require; a plain `go build` without one has no offline fallback.
+//
+//go:embed spec
+var bundledSpecFS embed.FS
+
+const bundledSpecFile = "spec/openapi-public.yml"
+
+// bundledSpec returns the embedded OpenAPI specification, or nil if this binary
+// was built without one.
+func bundledSpec() []byte {
+	content, err := bundledSpecFS.ReadFile(bundledSpecFile)
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// loadBundledSpec parses the embedded OpenAPI specification.
+// Returns nil if there is none or it cannot be parsed.
+func loadBundledSpec(loader *openapi3.Loader) *openapi3.T {
+	content := bundledSpec()
+	if content == nil {
+		return nil
+	}
+
+	// Relative references resolve against the configured host, like a downloaded spec
+	location := &url.URL{Scheme: "https", Host: ScalrHostname, Path: "/api/iacp/v3/openapi-public.yml"}
+
+	doc, err := loader.LoadFromDataWithPath(content, location)
+	if err != nil {
+		return nil
+	}
+
+	return doc
+}
+
+// loadSpecOverride loads the spec from an explicit path or URL given by -spec or SCALR_SPEC.
+// Exits with an error rather than falling back, since the user asked for this spec.
+func loadSpecOverride(loader *openapi3.Loader, location string) *openapi3.T {
+	var doc *openapi3.T
+	var err error
+
+	if isSpecURL(location) {
+		var specURL *url.URL
+		specURL, err = url.Parse(location)
+		if err == nil {
+			doc, err = loader.LoadFromURI(specURL)
+		}
+	} else {
+		doc, err = loader.LoadFromFile(location)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Could not load API specification from %s: %s\n", location, err)
+		os.Exit(ExitError)
+	}
+
+	return doc
+}
+
+// isSpecURL reports whether a spec location is a URL rather than a local file.
+func isSpecURL(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// specMeta holds the HTTP validators of a cached spec, so a refresh can ask the
+// server whether it changed instead of downloading it again.
+type specMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	CheckedAt    time.Time `json:"checked-at,omitempty"` // last time the server said the cached copy is current
+}
+
+// specMetaPath returns where the validators of a cached spec are kept.
+func specMetaPath(specPath string) string {
+	return strings.TrimSuffix(specPath, ".yml") + ".meta.json"
+}
+
+// readSpecMeta returns the validators stored for a cached spec, or none.
+func readSpecMeta(specPath string) specMeta {
+	var meta specMeta
+
+	content, err := os.ReadFile(specMetaPath(specPath))
+	if err == nil {
+		json.Unmarshal(content, &meta)
+	}
+
+	return meta
+}
+
+// writeSpecMeta stores the validators of a cached spec. Failures are ignored,
+// the next refresh simply downloads the spec in full.
+func writeSpecMeta(specPath string, meta specMeta) {
+	if meta.ETag == "" && meta.LastModified == "" {
+		os.Remove(specMetaPath(specPath))
+		return
+	}
+
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	os.WriteFile(specMetaPath(specPath), content, 0600)
+}
+
+// downloadSpec downloads the spec to fileName with a conditional GET based on meta.
+// Reports notModified, and writes nothing, if the server says the cached copy is current.
+func downloadSpec(URL string, fileName string, meta specMeta) (specMeta, bool, error) {
+
+	client := &http.Client{}
+
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return meta, false, err
+	}
+
+	req.Header.Set("User-Agent", "scalr-cli/"+versionCLI)
+
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return meta, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return meta, true, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return meta, false, err
+	}
+
+	if resp.StatusCode != 200 {
+		return meta, false, fmt.Errorf("received non-200 response code (%d) from server", resp.StatusCode)
+	}
+
+	if err := os.WriteFile(fileName, body, 0600); err != nil {
+		return meta, false, err
+	}
+
+	return specMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, false, nil
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// runSpecCommand dispatches `scalr spec <subcommand>`.
+func runSpecCommand(args []string) {
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+
+	switch {
+	case subcommand == "status":
+		specStatus()
+	case subcommand == "pin" && len(args) <= 2:
+		pinSpec(args[1:])
+	case subcommand == "unpin":
+		unpinSpec()
+	case subcommand == "diff" && len(args) == 3:
+		diffSpecs(args[1], args[2])
+	case subcommand == "refresh":
+		refreshSpec()
+	case subcommand == "clear" && (len(args) == 1 || args[1] == "-all"):
+		clearSpecCache(len(args) == 2)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: scalr spec <subcommand>")
+		fmt.Fprintln(os.Stderr, "  scalr spec status              Show which API specification is in use")
+		fmt.Fprintln(os.Stderr, "  scalr spec pin [file-or-url]   Keep using the current (or given) specification, never refresh it")
+		fmt.Fprintln(os.Stderr, "  scalr spec unpin               Go back to the automatically refreshed specification")
+		fmt.Fprintln(os.Stderr, "  scalr spec diff <old> <new>    List added and removed commands, flags, required flags and values")
+		fmt.Fprintln(os.Stderr, "  scalr spec refresh             Download the specification for this host now")
+		fmt.Fprintln(os.Stderr, "  scalr spec clear [-all]        Remove the cached specification of this host (or of all hosts)")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  <old> and <new> are a file path, a URL, or one of: pinned, cached, bundled, latest")
+		os.Exit(ExitError)
+	}
+}
+
+// pinSpec stores a copy of the specification that the CLI uses from now on instead of
+// the cache, so upstream changes are only adopted after reviewing them with `spec diff`.
+func pinSpec(args []string) {
+	location := SpecOverride
+	if len(args) > 0 {
+		location = args[0]
+	}
+
+	if location == "" && specPinned() {
+		fmt.Println("The API specification is already pinned: " + specPinPath())
+		fmt.Println("To adopt the latest one, review it with 'scalr spec diff pinned latest', then run 'scalr spec unpin' and 'scalr spec pin'.")
+		return
+	}
+
+	loader := newSpecLoader()
+
+	os.MkdirAll(specCacheDir(), 0700)
+
+	tmpFile := specPinPath() + ".tmp"
+	defer os.Remove(tmpFile)
+
+	var err error
+
+	switch {
+	case isSpecURL(location):
+		err = downloadFile(location, tmpFile)
+	case location != "":
+		var content []byte
+		if content, err = os.ReadFile(location); err == nil {
+			err = os.WriteFile(tmpFile, content, 0600)
+		}
+	default:
+		//Pin what is in use right now, downloading it first if nothing is cached yet
+		loadCachedSpec(loader)
+
+		content, readErr := os.ReadFile(specCachePath())
+		if readErr != nil {
+			content = bundledSpec()
+		}
+		err = os.WriteFile(tmpFile, content, 0600)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Could not pin API specification:", err)
+		os.Exit(ExitError)
+	}
+
+	doc, err := loader.LoadFromFile(tmpFile)
+	if err == nil {
+		err = doc.Validate(loader.Context)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: Refusing to pin an invalid API specification:", err)
+		os.Exit(ExitError)
+	}
+
+	err = os.Rename(tmpFile, specPinPath())
+	checkErr(err)
+
+	fmt.Printf("Pinned API specification %s (%d commands) to %s\n", specVersion(doc), len(buildCommandIndex(doc).Commands), specPinPath())
+	fmt.Println("It will not be refreshed until you run 'scalr spec unpin'.")
+}
+
+// unpinSpec removes the pinned specification, so the cache is used and refreshed again.
+func unpinSpec() {
+	if _, err := os.Stat(specPinPath()); err != nil {
+		fmt.Println("No API specification is pinned.")
+		return
+	}
+
+	err := os.Remove(specPinPath())
+	checkErr(err)
+
+	os.Remove(strings.TrimSuffix(specPinPath(), ".yml") + ".index.json")
+
+	fmt.Println("Unpinned the API specification. The cached specification is used and refreshed every 24 hours again.")
+}
+
+// refreshSpec updates the cached specification of the current host right away,
+// regardless of its age. Unchanged specs are revalidated, not downloaded again.
+func refreshSpec() {
+	os.MkdirAll(specCacheDir(), 0700)
+
+	before, _ := os.ReadFile(specCachePath())
+
+	loader := newSpecLoader()
+
+	doc, err := downloadAndValidateSpec(loader, specURL(), specCachePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Could not download API specification from %s: %s\n", ScalrHostname, err)
+		os.Exit(ExitError)
+	}
+
+	after, _ := os.ReadFile(specCachePath())
+
+	if bytes.Equal(before, after) {
+		fmt.Printf("API specification %s for %s is up to date.\n", specVersion(doc), ScalrHostname)
+	} else {
+		fmt.Printf("Downloaded API specification %s for %s (%d commands).\n", specVersion(doc), ScalrHostname, len(buildCommandIndex(doc).Commands))
+	}
+
+	if specPinned() {
+		fmt.Println("Note: a pinned specification is in use. Review the changes with 'scalr spec diff pinned cached'.")
+	}
+}
+
+// clearSpecCache removes the cached specification of the current host, or of all
+// hosts, along with the indexes built from them. Pinned specifications are kept.
+func clearSpecCache(all bool) {
+	var files []string
+
+	if all {
+		for _, pattern := range []string{"cache-openapi-public*", "index-*.json"} {
+			matches, _ := filepath.Glob(specCacheDir() + pattern)
+			files = append(files, matches...)
+		}
+	} else {
+		spec := specCachePath()
+		files = []string{spec, spec + ".tmp", specMetaPath(spec), strings.TrimSuffix(spec, ".yml") + ".index.json"}
+	}
+
+	removed := 0
+	for _, file := range files {
+		if err := os.Remove(file); err == nil {
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		fmt.Println("Nothing to clear.")
+		return
+	}
+
+	fmt.Printf("Removed %d cached file(s) from %s\n", removed, specCacheDir())
+
+	if specPinned() {
+		fmt.Println("The pinned specification is kept. Run 'scalr spec unpin' to remove it.")
+	}
+}
+
+// specStatus prints which specification is in use, where it comes from and its version.
+// Never downloads anything.
+func specStatus() {
+	loader := newSpecLoader()
+
+	var source, location, refresh string
+	var doc *openapi3.T
+
+	switch {
+	case SpecOverride != "":
+		source = configSources["spec"]
+		location = SpecOverride
+		refresh = "never, given explicitly"
+		doc = loadSpecOverride(loader, SpecOverride)
+	case specPinned():
+		source = "pinned"
+		location = specPinPath()
+		refresh = "never, run 'scalr spec unpin' to resume"
+	default:
+		source = "cache"
+		location = specCachePath()
+		refresh = "when older than 24h"
+	}
+
+	var modified time.Time
+
+	if doc == nil {
+		if info, err := os.Stat(location); err == nil {
+			modified = info.ModTime()
+
+			var err error
+			doc, err = loader.LoadFromFile(location)
+			checkErr(err)
+		} else if doc = loadBundledSpec(loader); doc != nil {
+			source = "bundled with this binary, nothing cached yet"
+			location = "(embedded)"
+		} else {
+			source = "none, downloaded on first use"
+		}
+	} else if info, err := os.Stat(location); err == nil {
+		modified = info.ModTime()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "source\t%s\n", source)
+	fmt.Fprintf(w, "location\t%s\n", location)
+
+	if doc != nil {
+		fmt.Fprintf(w, "version\t%s\n", specVersion(doc))
+		fmt.Fprintf(w, "commands\t%d\n", len(buildCommandIndex(doc).Commands))
+	}
+
+	if !modified.IsZero() {
+		fmt.Fprintf(w, "modified\t%s (%s ago)\n", modified.Format(time.RFC3339), time.Since(modified).Truncate(time.Second))
+	}
+
+	fmt.Fprintf(w, "refreshed\t%s\n", refresh)
+	w.Flush()
+}
+
+// diffSpecs prints the changes between two specifications as they affect CLI usage.
+func diffSpecs(oldRef string, newRef string) {
+	oldIndex := buildCommandIndex(loadSpecRef(oldRef))
+	newIndex := buildCommandIndex(loadSpecRef(newRef))
+
+	changes := diffCommandIndexes(oldIndex, newIndex)
+
+	if len(changes) == 0 {
+		fmt.Println("No changes to commands or flags.")
+		return
+	}
+
+	for _, line := range changes {
+		fmt.Println(line)
+	}
+}
+
+// loadSpecRef loads a specification named on the `spec diff` command line.
+func loadSpecRef(ref string) *openapi3.T {
+	loader := newSpecLoader()
+
+	switch ref {
+	case "pinned", "cached":
+		location := specPinPath()
+		if ref == "cached" {
+			location = specCachePath()
+		}
+
+		if _, err := os.Stat(location); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: No %s API specification found at %s\n", ref, location)
+			os.Exit(ExitError)
+		}
+
+		doc, err := loader.LoadFromFile(location)
+		checkErr(err)
+
+		return doc
+	case "bundled":
+		doc := loadBundledSpec(loader)
+		if doc == nil {
+			fmt.Fprintln(os.Stderr, "Error: This binary was built without a bundled API specification")
+			os.Exit(ExitError)
+		}
+
+		return doc
+	case "latest":
+		return loadSpecOverride(loader, specURL())
+	}
+
+	return loadSpecOverride(loader, ref)
+}
+
+// specVersion returns the version declared in the spec's info section.
+func specVersion(doc *openapi3.T) string {
+	if doc.Info == nil || doc.Info.Version == "" {
+		return "(unversioned)"
+	}
+
+	return doc.Info.Version
+}
+
+// diffCommandIndexes lists added and removed commands, and for changed commands
+// the added and removed flags, flags whose type or required state changed, and
+// added and removed allowed values. Lines are prefixed with +, - or ~.
+func diffCommandIndexes(oldIndex *CommandIndex, newIndex *CommandIndex) []string {
+	var changes []string
+
+	for _, name := range unionKeys(oldIndex.Commands, newIndex.Commands) {
+		oldCmd, newCmd := oldIndex.Commands[name], newIndex.Commands[name]
+
+		switch {
+		case oldCmd == nil:
+			changes = append(changes, "+ "+name)
+		case newCmd == nil:
+			changes = append(changes, "- "+name)
+		default:
+			if details := diffCommandFlags(oldCmd, newCmd); len(details) > 0 {
+				changes = append(changes, "~ "+name)
+				for _, detail := range details {
+					changes = append(changes, "    "+detail)
+				}
+			}
+		}
+	}
+
+	return changes
+}
+
+// diffCommandFlags lists the flag changes of a single command.
+func diffCommandFlags(oldCmd *IndexCommand, newCmd *IndexCommand) []string {
+	oldFlags := make(map[string]*IndexFlag)
+	for i := range oldCmd.Flags {
+		oldFlags[oldCmd.Flags[i].Name] = &oldCmd.Flags[i]
+	}
+
+	newFlags := make(map[string]*IndexFlag)
+	for i := range newCmd.Flags {
+		newFlags[newCmd.Flags[i].Name] = &newCmd.Flags[i]
+	}
+
+	var details []string
+
+	for _, name := range unionKeys(oldFlags, newFlags) {
+		oldFlag, newFlag := oldFlags[name], newFlags[name]
+
+		switch {
+		case oldFlag == nil:
+			line := "+ -" + name + "=" + displayType(newFlag.Type)
+			if newFlag.Required {
+				line += " (required)"
+			}
+			details = append(details, line)
+			continue
+		case newFlag == nil:
+			details = append(details, "- -"+name)
+			continue
+		}
+
+		if oldFlag.Type != newFlag.Type {
+			details = append(details, fmt.Sprintf("~ -%s type changed from %s to %s", name, displayType(oldFlag.Type), displayType(newFlag.Type)))
+		}
+
+		if !oldFlag.Required && newFlag.Required {
+			details = append(details, "~ -"+name+" is now required")
+		} else if oldFlag.Required && !newFlag.Required {
+			details = append(details, "~ -"+name+" is no longer required")
+		}
+
+		switch {
+		case len(oldFlag.Enum) == 0 && len(newFlag.Enum) > 0:
+			details = append(details, "~ -"+name+" now only accepts: "+strings.Join(newFlag.Enum, ", "))
+		case len(oldFlag.Enum) > 0 && len(newFlag.Enum) == 0:
+			details = append(details, "~ -"+name+" now accepts any value")
+		default:
+			for _, value := range missingValues(newFlag.Enum, oldFlag.Enum) {
+				details = append(details, "+ -"+name+" value "+value)
+			}
+			for _, value := range missingValues(oldFlag.Enum, newFlag.Enum) {
+				details = append(details, "- -"+name+" value "+value)
+			}
+		}
+	}
+
+	return details
+}
+
+// unionKeys returns the sorted keys present in either map.
+func unionKeys[V any](a map[string]V, b map[string]V) []string {
+	seen := make(map[string]bool)
+	for key := range a {
+		seen[key] = true
+	}
+	for key := range b {
+		seen[key] = true
+	}
+
+	return sortedKeys(seen)
+}
+
+// missingValues returns the values of a that are not in b, sorted.
+func missingValues(a []string, b []string) []string {
+	in := make(map[string]bool)
+	for _, value := range b {
+		in[value] = true
+	}
+
+	var missing []string
+	for _, value := range a {
+		if !in[value] {
+			missing = append(missing, value)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
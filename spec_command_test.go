@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffCommandIndexes(t *testing.T) {
+	oldIndex := &CommandIndex{Commands: map[string]*IndexCommand{
+		"get-workspaces": {},
+		"delete-tag":     {},
+		"create-workspace": {Flags: []IndexFlag{
+			{Name: "auto-apply", Type: "boolean"},
+			{Name: "execution-mode", Type: "string", Enum: []string{"local", "remote"}},
+			{Name: "max-count", Type: "integer"},
+			{Name: "name", Type: "string"},
+			{Name: "old-flag", Type: "string"},
+			{Name: "terraform-version", Type: "string"},
+		}},
+	}}
+
+	newIndex := &CommandIndex{Commands: map[string]*IndexCommand{
+		"get-workspaces": {},
+		"create-tag":     {},
+		"create-workspace": {Flags: []IndexFlag{
+			{Name: "auto-apply", Type: "boolean"},
+			{Name: "environment-id", Type: "string", Required: true},
+			{Name: "execution-mode", Type: "string", Enum: []string{"agent", "remote"}},
+			{Name: "max-count", Type: "string"},
+			{Name: "name", Type: "string", Required: true},
+			{Name: "terraform-version", Type: "string", Enum: []string{"1.5"}},
+		}},
+	}}
+
+	want := []string{
+		"+ create-tag",
+		"~ create-workspace",
+		"    + -environment-id=STRING (required)",
+		"    + -execution-mode value agent",
+		"    - -execution-mode value local",
+		"    ~ -max-count type changed from INTEGER to STRING",
+		"    ~ -name is now required",
+		"    - -old-flag",
+		"    ~ -terraform-version now only accepts: 1.5",
+		"- delete-tag",
+	}
+
+	if got := diffCommandIndexes(oldIndex, newIndex); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffCommandIndexes() =\n%v\nwant\n%v", got, want)
+	}
+
+	if got := diffCommandIndexes(newIndex, newIndex); len(got) != 0 {
+		t.Errorf("expected no changes between identical indexes, got %v", got)
+	}
+}
+
+func TestPinSpec(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	if specPinned() {
+		t.Fatal("nothing should be pinned yet")
+	}
+
+	pinSpec([]string{"testdata/openapi-test.yml"})
+
+	if !specPinned() {
+		t.Fatal("expected the spec to be pinned")
+	}
+	if specFile, _ := indexLocation(); specFile != specPinPath() {
+		t.Errorf("expected the pinned spec to be used, got %s", specFile)
+	}
+	if loadSpecRef("pinned").Paths.Find("/workspaces") == nil {
+		t.Error("pinned spec is not the one given")
+	}
+
+	unpinSpec()
+
+	if specPinned() {
+		t.Error("expected the pin to be removed")
+	}
+}
+
+func TestClearSpecCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	old := ScalrHostname
+	defer func() { ScalrHostname = old }()
+
+	os.MkdirAll(specCacheDir(), 0700)
+
+	ScalrHostname = "other.scalr.io"
+	other := specCachePath()
+	os.WriteFile(other, []byte("other"), 0600)
+
+	ScalrHostname = "example.scalr.io"
+	for _, file := range []string{specCachePath(), specMetaPath(specCachePath()), strings.TrimSuffix(specCachePath(), ".yml") + ".index.json", specPinPath()} {
+		os.WriteFile(file, []byte("x"), 0600)
+	}
+
+	captureStdout(t, func() { clearSpecCache(false) })
+
+	if _, err := os.Stat(specCachePath()); err == nil {
+		t.Error("expected the cache of this host to be removed")
+	}
+	if _, err := os.Stat(specMetaPath(specCachePath())); err == nil {
+		t.Error("expected the validators of this host to be removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("the cache of other hosts must be kept")
+	}
+	if !specPinned() {
+		t.Error("the pinned spec must be kept")
+	}
+
+	captureStdout(t, func() { clearSpecCache(true) })
+
+	if _, err := os.Stat(other); err == nil {
+		t.Error("expected -all to remove the cache of every host")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSpecOverride_File(t *testing.T) {
+	doc := loadSpecOverride(newSpecLoader(), "testdata/openapi-test.yml")
+
+	if doc.Paths.Find("/workspaces") == nil {
+		t.Fatal("expected /workspaces path in test spec")
+	}
+	if got := basePathFromSpec(doc); got != "/api/iacp/v3" {
+		t.Errorf("expected base path /api/iacp/v3, got %q", got)
+	}
+}
+
+func TestSpecCachePath_PerHost(t *testing.T) {
+	old := ScalrHostname
+	defer func() { ScalrHostname = old }()
+
+	ScalrHostname = "example.scalr.io"
+	first := specCachePath()
+
+	ScalrHostname = "scalr.internal:8443"
+	second := specCachePath()
+
+	if first == second {
+		t.Fatalf("expected different cache files per host, got %s for both", first)
+	}
+	if !strings.HasSuffix(first, "cache-openapi-public.example.scalr.io.yml") {
+		t.Errorf("unexpected cache file %s", first)
+	}
+	if !strings.HasSuffix(second, "cache-openapi-public.scalr.internal_8443.yml") {
+		t.Errorf("port must be made file name safe, got %s", second)
+	}
+}
+
+func TestDownloadSpec_Conditional(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 10:00:00 GMT")
+		w.Write([]byte("openapi: 3.0.0"))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "spec.yml")
+
+	meta, notModified, err := downloadSpec(server.URL, file, specMeta{})
+	if err != nil || notModified {
+		t.Fatalf("first download: notModified=%v err=%v", notModified, err)
+	}
+	if meta.ETag != `"v1"` || meta.LastModified == "" {
+		t.Errorf("validators not recorded: %+v", meta)
+	}
+	if content, _ := os.ReadFile(file); string(content) != "openapi: 3.0.0" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	writeSpecMeta(file, meta)
+	os.Remove(file)
+
+	_, notModified, err = downloadSpec(server.URL, file, readSpecMeta(file))
+	if err != nil || !notModified {
+		t.Fatalf("second download: notModified=%v err=%v", notModified, err)
+	}
+	if _, err := os.Stat(file); err == nil {
+		t.Error("nothing should be written when the spec is not modified")
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestSpecNeedsRefresh_CheckedAt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.yml")
+	os.WriteFile(file, []byte("openapi: 3.0.0"), 0600)
+
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(file, old, old)
+
+	info, _ := os.Stat(file)
+	if !specNeedsRefresh(file, info) {
+		t.Error("a spec downloaded two days ago needs a refresh")
+	}
+
+	//A 304 records the check without touching the spec, so the index stamp stays valid
+	writeSpecMeta(file, specMeta{ETag: `"v1"`, CheckedAt: time.Now()})
+	if specNeedsRefresh(file, info) {
+		t.Error("a spec found unchanged just now does not need a refresh")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateFlagValue checks a flag value against the schema rules recorded in the
+// command index, so mistakes are reported before anything is sent to the API.
+// Returns an error naming the flag and, where there are any, the allowed values.
+func validateFlagValue(f *IndexFlag, value string) error {
+	//Objects and lists of objects are checked while their JSON is parsed
+	if f.Type == "object" || f.Items == "object" {
+		return nil
+	}
+
+	if f.Type != "array" {
+		return validateScalar(f, f.Type, value)
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		if err := validateScalar(f, f.Items, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateScalar checks a single value, or a single item of a list.
+func validateScalar(f *IndexFlag, varType string, value string) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("Invalid value '%s' for -%s: %s", value, f.Name, fmt.Sprintf(format, args...))
+	}
+
+	switch varType {
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return invalid("expected BOOLEAN. Allowed values: [ true, false ]")
+		}
+
+	case "integer", "number":
+		var number float64
+		var err error
+
+		if varType == "integer" {
+			var integer int64
+			integer, err = strconv.ParseInt(value, 10, 64)
+			number = float64(integer)
+		} else {
+			number, err = strconv.ParseFloat(value, 64)
+		}
+
+		if err != nil {
+			return invalid("expected %s", displayType(varType))
+		}
+
+		if f.Min != nil && number < *f.Min {
+			return invalid("must be at least %v", *f.Min)
+		}
+
+		if f.Max != nil && number > *f.Max {
+			return invalid("must be at most %v", *f.Max)
+		}
+	}
+
+	if len(f.Enum) > 0 && !containsString(f.Enum, value) {
+		return invalid("allowed values: [ %s ]", strings.Join(f.Enum, ", "))
+	}
+
+	length := uint64(len([]rune(value)))
+
+	if length < f.MinLength {
+		return invalid("must be at least %d characters long", f.MinLength)
+	}
+
+	if f.MaxLength != nil && length > *f.MaxLength {
+		return invalid("must be at most %d characters long", *f.MaxLength)
+	}
+
+	//Patterns are ECMAScript regular expressions; the ones Go cannot compile are left to the server
+	if f.Pattern != "" {
+		if pattern, err := regexp.Compile(f.Pattern); err == nil && !pattern.MatchString(value) {
+			return invalid("must match the pattern %s", f.Pattern)
+		}
+	}
+
+	switch f.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return invalid("expected a date and time like 2006-01-02T15:04:05Z")
+		}
+
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return invalid("expected a date like 2006-01-02")
+		}
+
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return invalid("expected an email address")
+		}
+
+	case "uri", "url":
+		if u, err := url.ParseRequestURI(value); err != nil || u.Scheme == "" {
+			return invalid("expected a URL like https://example.com")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFlagValue(t *testing.T) {
+	cmd := testIndex(t).Commands["create-workspace"]
+
+	tests := []struct {
+		flag    string
+		value   string
+		wantErr string
+	}{
+		{"auto-apply", "true", ""},
+		{"auto-apply", "yes", "Invalid value 'yes' for -auto-apply: expected BOOLEAN. Allowed values: [ true, false ]"},
+		{"max-count", "3", ""},
+		{"max-count", "abc", "Invalid value 'abc' for -max-count: expected INTEGER"},
+		{"max-count", "1.5", "expected INTEGER"},
+		{"max-count", "0", "must be at least 1"},
+		{"max-count", "11", "must be at most 10"},
+		{"cost", "1.25", ""},
+		{"cost", "cheap", "expected NUMBER"},
+		{"execution-mode", "remote", ""},
+		{"execution-mode", "agent", "Invalid value 'agent' for -execution-mode: allowed values: [ remote, local ]"},
+		{"name", "my-workspace", ""},
+		{"name", "My Workspace", "must match the pattern ^[a-z0-9-]+$"},
+		{"trigger-prefixes", "a,b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flag+"="+tt.value, func(t *testing.T) {
+			f := cmd.flag(tt.flag)
+			if f == nil {
+				t.Fatalf("flag -%s not in index", tt.flag)
+			}
+
+			err := validateFlagValue(f, tt.value)
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("expected error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFlagValue_Formats(t *testing.T) {
+	maxLength := uint64(5)
+
+	tests := []struct {
+		flag  IndexFlag
+		value string
+		valid bool
+	}{
+		{IndexFlag{Name: "at", Type: "string", Format: "date-time"}, "2026-10-19T10:00:00Z", true},
+		{IndexFlag{Name: "at", Type: "string", Format: "date-time"}, "yesterday", false},
+		{IndexFlag{Name: "on", Type: "string", Format: "date"}, "2026-10-19", true},
+		{IndexFlag{Name: "on", Type: "string", Format: "date"}, "19/10/2026", false},
+		{IndexFlag{Name: "email", Type: "string", Format: "email"}, "ci@example.com", true},
+		{IndexFlag{Name: "email", Type: "string", Format: "email"}, "ci", false},
+		{IndexFlag{Name: "url", Type: "string", Format: "uri"}, "https://example.com/hook", true},
+		{IndexFlag{Name: "url", Type: "string", Format: "uri"}, "example", false},
+		{IndexFlag{Name: "code", Type: "string", MinLength: 2, MaxLength: &maxLength}, "abc", true},
+		{IndexFlag{Name: "code", Type: "string", MinLength: 2, MaxLength: &maxLength}, "a", false},
+		{IndexFlag{Name: "code", Type: "string", MinLength: 2, MaxLength: &maxLength}, "abcdef", false},
+		{IndexFlag{Name: "ids", Type: "array", Items: "integer"}, "1,2,3", true},
+		{IndexFlag{Name: "ids", Type: "array", Items: "integer"}, "1,two", false},
+		{IndexFlag{Name: "modes", Type: "array", Items: "string", Enum: []string{"a", "b"}}, "a,c", false},
+		// ECMAScript-only syntax Go cannot compile is left to the server
+		{IndexFlag{Name: "id", Type: "string", Pattern: `^(?!x)`}, "x", true},
+	}
+
+	for _, tt := range tests {
+		err := validateFlagValue(&tt.flag, tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("-%s=%s: valid=%v, got error %v", tt.flag.Name, tt.value, tt.valid, err)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
@@ -34,30 +38,156 @@ var successStates = map[string]bool{
 	"planned_and_finished": true,
 }
 
+// Outcomes of waiting for a run, as reported by runOutcome and in the summary of several runs.
+const (
+	outcomeSuccess      = "success"              // reached one of the successStates
+	outcomeChanges      = "planned-with-changes" // plan-only run finished and the plan has changes
+	outcomeFailed       = "failed"               // reached any other terminal state
+	outcomeBlocked      = "blocked"              // waits for a policy override or cost approval
+	outcomeConfirmation = "needs-confirmation"   // planned, but auto-apply is disabled
+	outcomeTimeout      = "timeout"              // still running when the timeout expired
+	outcomeError        = "error"                // the run could not be read
+)
+
+// runOutcome tells whether waiting for a run is over at its current status, and how it
+// ended. Returns "" while the run is still expected to progress on its own.
+func runOutcome(status string, runData *gabs.Container) string {
+	if terminalStates[status] {
+		if successStates[status] {
+			return outcomeSuccess
+		}
+		return outcomeFailed
+	}
+
+	// Hard stop: states that definitely block on human input regardless of config
+	// (policy override or cost approval).
+	if blockedOnApprovalStates[status] {
+		return outcomeBlocked
+	}
+
+	// "planned" is ambiguous — the run auto-applies if auto-apply is on, otherwise
+	// it sits waiting for manual confirmation. Check the run's auto-apply flag.
+	// If auto-apply is off, the run is effectively blocked.
+	if status == "planned" {
+		autoApply, ok := runData.Path("auto-apply").Data().(bool)
+		if ok && !autoApply {
+			return outcomeConfirmation
+		}
+		// Otherwise keep polling — the run will transition to confirmed/applying shortly.
+	}
+	// "confirmed" is a brief transitional state on the way to applying; just keep polling.
+
+	return ""
+}
+
+// withPlanChanges tells apart plan-only runs whose plan has changes from those without. The
+// plan is only read once the run finished. If it cannot be read, the outcome is an error, as
+// the run must not pass for one without changes.
+func withPlanChanges(outcome string, status string, runData *gabs.Container) (string, error) {
+	if outcome != outcomeSuccess || status != "planned_and_finished" {
+		return outcome, nil
+	}
+
+	if hasChanges, ok := runData.Path("has-changes").Data().(bool); ok {
+		if hasChanges {
+			return outcomeChanges, nil
+		}
+		return outcome, nil
+	}
+
+	planID := relatedID(runData, "plan")
+	if planID == "" {
+		return outcome, nil
+	}
+
+	plan, err := runRequest("GET", "/plans/"+planID, nil)
+	if err != nil {
+		return outcomeError, fmt.Errorf("plan %s could not be read: %w", planID, err)
+	}
+
+	if hasChanges, _ := plan.Path("data.attributes.has-changes").Data().(bool); hasChanges {
+		return outcomeChanges, nil
+	}
+
+	return outcome, nil
+}
+
+// runExitCode returns the exit code of wait-for-run for how waiting for a run ended.
+func runExitCode(outcome string, status string) int {
+	switch outcome {
+	case outcomeSuccess:
+		return ExitSuccess
+	case outcomeChanges:
+		return ExitPlanChanges
+	case outcomeFailed:
+		if status == "errored" {
+			return ExitRunErrored
+		}
+		return ExitRunCanceled
+	case outcomeBlocked:
+		return ExitRunPolicyBlocked
+	case outcomeConfirmation:
+		return ExitRunNeedsConfirmation
+	case outcomeTimeout:
+		return ExitTimeout
+	default:
+		return ExitError
+	}
+}
+
+// WaitOptions controls how wait-for-run follows runs.
+type WaitOptions struct {
+	Timeout          time.Duration // how long to wait for all runs together
+	Logs             bool          // stream the plan and apply logs to stderr
+	OnPlanned        string        // apply, discard or fail a run that needs confirmation
+	OnPolicySoftFail string        // override or fail soft-mandatory policies that failed
+	ApproveBelow     float64       // approve cost estimates below this amount, 0 to fail
+	Comment          string        // recorded with every action taken on a run
+	Events           string        // "ndjson" to write every poll and transition to stdout
+}
+
 // waitForRun polls a run until it reaches a terminal state.
 // Prints status transitions to stderr and exits with appropriate code.
-func waitForRun(runID string, timeout time.Duration) {
+func waitForRun(runID string, opts WaitOptions) {
 
 	if runID == "" {
-		fmt.Fprintln(os.Stderr, "Error: -run flag is required")
+		fmt.Fprintln(os.Stderr, "Error: -run or -workspace flag is required")
 		os.Exit(ExitError)
 	}
 
+	timeout := opts.Timeout
 	deadline := time.Now().Add(timeout)
 	interval := 2 * time.Second
 	maxInterval := 10 * time.Second
 	lastStatus := ""
 
+	// Logs are polled more often so they read like a live stream
+	var logs *runLogs
+	if opts.Logs {
+		logs = &runLogs{printed: make(map[string]int)}
+		maxInterval = 3 * time.Second
+	}
+
+	gate := newRunGate(opts)
+	events := newEventStream(opts.Events)
+
 	fmt.Fprintf(os.Stderr, "Waiting for run %s...\n", runID)
 
 	for {
 		if time.Now().After(deadline) {
+			events.emit(waitEvent{Type: eventDone, Run: runID, NewStatus: lastStatus, Outcome: outcomeTimeout})
 			fmt.Fprintf(os.Stderr, "Error: Timeout waiting for run %s after %s\n", runID, timeout)
-			os.Exit(ExitTransientError)
+			os.Exit(ExitTimeout)
 		}
 
 		status, runData := fetchRunStatus(runID)
 
+		if logs != nil {
+			logs.follow(status, runData)
+		}
+
+		events.status(runID, lastStatus, status)
+
 		if status != lastStatus {
 			if lastStatus != "" {
 				fmt.Fprintf(os.Stderr, "%s -> %s\n", lastStatus, status)
@@ -67,40 +197,47 @@ func waitForRun(runID string, timeout time.Duration) {
 			lastStatus = status
 		}
 
-		if terminalStates[status] {
-			// Print the final run data to stdout
-			fmt.Println(runData.StringIndent("", "  "))
+		outcome := runOutcome(status, runData)
 
-			if successStates[status] {
-				fmt.Fprintf(os.Stderr, "Run %s completed successfully (%s)\n", runID, status)
-				os.Exit(ExitSuccess)
-			} else {
-				fmt.Fprintf(os.Stderr, "Run %s finished with status: %s\n", runID, status)
-				os.Exit(ExitError)
+		// Runs blocked on a human may be continued by the -on-* policies
+		continued, note := gate.handle(runID, status, outcome, runData)
+		outcome, err := withPlanChanges(outcome, status, runData)
+		if err != nil {
+			note = fmt.Sprintf("Error: Run %s finished with status %s, but %s", runID, status, err)
+		}
+		if note != "" {
+			fmt.Fprintln(os.Stderr, note)
+		}
+		if continued {
+			outcome = ""
+			if note != "" {
+				events.emit(waitEvent{Type: eventAction, Run: runID, NewStatus: status, Message: note})
 			}
 		}
 
-		// Hard stop: states that definitely block on human input regardless of config
-		// (policy override or cost approval).
-		if blockedOnApprovalStates[status] {
+		// Print the final run data to stdout, as part of the last event when streaming events
+		if outcome != "" && events != nil {
+			events.emit(waitEvent{Type: eventDone, Run: runID, NewStatus: status, Outcome: outcome, Message: note, Data: runData.Bytes()})
+		} else if outcome != "" {
 			fmt.Println(runData.StringIndent("", "  "))
+		}
+
+		switch outcome {
+		case outcomeSuccess:
+			fmt.Fprintf(os.Stderr, "Run %s completed successfully (%s)\n", runID, status)
+		case outcomeChanges:
+			fmt.Fprintf(os.Stderr, "Run %s completed successfully (%s), the plan has changes\n", runID, status)
+		case outcomeFailed:
+			fmt.Fprintf(os.Stderr, "Run %s finished with status: %s\n", runID, status)
+		case outcomeBlocked:
 			fmt.Fprintf(os.Stderr, "Run %s is blocked waiting for approval (status: %s). Cannot proceed automatically.\n", runID, status)
-			os.Exit(ExitError)
+		case outcomeConfirmation:
+			fmt.Fprintf(os.Stderr, "Run %s requires manual confirmation (auto-apply is disabled). Cannot proceed automatically.\n", runID)
 		}
 
-		// "planned" is ambiguous — the run auto-applies if auto-apply is on, otherwise
-		// it sits waiting for manual confirmation. Check the run's auto-apply flag.
-		// If auto-apply is off, the run is effectively blocked.
-		if status == "planned" {
-			autoApply, ok := runData.Path("auto-apply").Data().(bool)
-			if ok && !autoApply {
-				fmt.Println(runData.StringIndent("", "  "))
-				fmt.Fprintf(os.Stderr, "Run %s requires manual confirmation (auto-apply is disabled). Cannot proceed automatically.\n", runID)
-				os.Exit(ExitError)
-			}
-			// Otherwise keep polling — the run will transition to confirmed/applying shortly.
+		if outcome != "" {
+			os.Exit(runExitCode(outcome, status))
 		}
-		// "confirmed" is a brief transitional state on the way to applying; just keep polling.
 
 		time.Sleep(interval)
 
@@ -114,8 +251,252 @@ func waitForRun(runID string, timeout time.Duration) {
 	}
 }
 
+// planningStates come before the plan of a run is complete, so its log may still grow.
+var planningStates = map[string]bool{
+	"pending":        true,
+	"queued":         true,
+	"prepare_queued": true,
+	"preparing":      true,
+	"plan_queued":    true,
+	"planning":       true,
+}
+
+// runLogs follows the plan log and then the apply log of a run for -logs.
+type runLogs struct {
+	printed  map[string]int // bytes of each log printed so far, by log endpoint
+	planDone bool           // the plan log is complete and fully printed
+}
+
+// follow prints what was added to the logs of a run since the last call, the plan log while
+// the run is planning and the apply log once the plan is over.
+func (l *runLogs) follow(status string, runData *gabs.Container) {
+	if planID := relatedID(runData, "plan"); planID != "" && !l.planDone {
+		l.print("/plans/" + planID + "/logs")
+
+		// Read after the plan was over, so nothing is missing
+		l.planDone = !planningStates[status]
+	}
+
+	if applyID := relatedID(runData, "apply"); applyID != "" && !planningStates[status] {
+		l.print("/applies/" + applyID + "/logs")
+	}
+}
+
+// print writes the part of a log that was not printed yet to stderr. Only that part is
+// requested, servers that ignore the range send the whole log and the rest is skipped. Logs
+// that cannot be read yet, like the apply log of a run that was not confirmed, are tried
+// again next time.
+func (l *runLogs) print(endpoint string) {
+	req, err := http.NewRequest("GET", "https://"+ScalrHostname+BasePath+endpoint, nil)
+	checkErr(err)
+
+	setScalrHeaders(req)
+
+	if l.printed[endpoint] > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", l.printed[endpoint]))
+	}
+
+	res, err := scalrHTTPClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	// 416 tells that nothing was added since the last call
+	content, err := io.ReadAll(res.Body)
+	if err != nil || res.StatusCode >= 300 {
+		return
+	}
+
+	// A partial response holds only the new part
+	added := content
+	if res.StatusCode != http.StatusPartialContent {
+		added = content[min(l.printed[endpoint], len(content)):]
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	// Terraform marks the start and end of its output with STX and ETX
+	os.Stderr.Write(bytes.Map(func(r rune) rune {
+		if r == '\x02' || r == '\x03' {
+			return -1
+		}
+		return r
+	}, added))
+
+	l.printed[endpoint] += len(added)
+}
+
+// relatedID returns the ID of a to-one relationship of an item returned by parseData.
+func relatedID(item *gabs.Container, name string) string {
+	related, _ := unwrapGabs(item.Path(name).Data()).(map[string]any)
+	id, _ := unwrapGabs(related["id"]).(string)
+	return id
+}
+
+// commitSHAPattern matches full and abbreviated Git commit SHAs.
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// findRun waits for a run of a workspace to appear and returns its ID. With a commit SHA as
+// since, that is the latest run of the commit. With a timestamp, it is the first run created
+// at or after it, and without since, the first run created from now on.
+func findRun(workspaceID string, since string, deadline time.Time) string {
+	var after time.Time
+	commit := ""
+
+	if since == "" {
+		after = time.Now()
+	} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+		after = t
+	} else if commitSHAPattern.MatchString(strings.ToLower(since)) {
+		commit = strings.ToLower(since)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: Invalid -since '%s', expected a timestamp like 2024-01-31T12:00:00Z or a commit SHA\n", since)
+		os.Exit(ExitError)
+	}
+
+	if commit != "" {
+		fmt.Fprintf(os.Stderr, "Waiting for a run of workspace %s for commit %s...\n", workspaceID, commit)
+	} else {
+		fmt.Fprintf(os.Stderr, "Waiting for a run of workspace %s created since %s...\n", workspaceID, after.Format(time.RFC3339))
+	}
+
+	interval := 2 * time.Second
+	maxInterval := 10 * time.Second
+	revisions := make(map[string]string) // commit SHAs of VCS revisions, by ID
+
+	for {
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "Error: Timeout waiting for a run of workspace %s\n", workspaceID)
+			os.Exit(ExitTimeout)
+		}
+
+		query := url.Values{}
+		query.Set("filter[workspace]", workspaceID)
+		query.Set("include", "vcs-revision")
+		query.Set("page[size]", "20")
+
+		runs := parseData(fetchJSON("/runs", query)).Children()
+
+		if runID := matchRun(runs, after, commit, revisions); runID != "" {
+			fmt.Fprintf(os.Stderr, "Found run %s\n", runID)
+			return runID
+		}
+
+		time.Sleep(interval)
+
+		if interval < maxInterval {
+			interval = min(interval+1*time.Second, maxInterval)
+		}
+	}
+}
+
+// matchRun returns the ID of the run findRun is looking for among the most recent runs of a
+// workspace, or "" if there is none yet. The commit of runs whose VCS revision was not
+// included in the response is fetched and remembered in revisions.
+func matchRun(runs []*gabs.Container, after time.Time, commit string, revisions map[string]string) string {
+	match := ""
+	var matchCreated time.Time
+
+	for _, run := range runs {
+		id, _ := unwrapGabs(run.Path("id").Data()).(string)
+		createdAt, _ := run.Path("created-at").Data().(string)
+		created, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			continue
+		}
+
+		if commit != "" {
+			sha := runCommit(run, revisions)
+			if sha == "" || !strings.HasPrefix(sha, commit) {
+				continue
+			}
+
+			//Runs retried for the same commit: the latest one counts
+			if match == "" || created.After(matchCreated) {
+				match, matchCreated = id, created
+			}
+			continue
+		}
+
+		if created.Before(after) {
+			continue
+		}
+
+		//Several runs since then: the first one is the one that was triggered
+		if match == "" || created.Before(matchCreated) {
+			match, matchCreated = id, created
+		}
+	}
+
+	return match
+}
+
+// runCommit returns the commit SHA a run was triggered for, or "" if it has none.
+func runCommit(run *gabs.Container, revisions map[string]string) string {
+	revision, _ := unwrapGabs(run.Path("vcs-revision").Data()).(map[string]any)
+
+	if sha, ok := unwrapGabs(revision["commit-sha"]).(string); ok {
+		return strings.ToLower(sha)
+	}
+
+	revisionID, ok := unwrapGabs(revision["id"]).(string)
+	if !ok || revisionID == "" {
+		return ""
+	}
+
+	if _, ok := revisions[revisionID]; !ok {
+		sha, _ := fetchJSON("/vcs-revisions/"+revisionID, nil).Path("data.attributes.commit-sha").Data().(string)
+		revisions[revisionID] = strings.ToLower(sha)
+	}
+
+	return revisions[revisionID]
+}
+
 // fetchRunStatus makes a GET request to fetch the run and returns its status and parsed data.
+// Exits if the run cannot be read.
 func fetchRunStatus(runID string) (string, *gabs.Container) {
+	status, item, err := getRun(runID)
+
+	if err != nil {
+		switch {
+		case err.StatusCode != 0:
+			showError(err.Body, err.StatusCode)
+		case err.Body != nil:
+			fmt.Fprintln(os.Stderr, "Error: Unexpected response format")
+			os.Exit(ExitError)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Request failed: %s\n", err.Err)
+			os.Exit(ExitTransientError)
+		}
+	}
+
+	return status, item
+}
+
+// runError is why a run could not be read.
+type runError struct {
+	StatusCode int    // HTTP status of an error response, 0 if there was none
+	Body       []byte // the response, if there was one
+	Err        error
+}
+
+func (e *runError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, apiErrorMessage(e.Body))
+	}
+	return e.Err.Error()
+}
+
+// permanent reports whether reading the run again cannot help, unlike after a failed request
+// or a server error.
+func (e *runError) permanent() bool {
+	return e.Body != nil && e.StatusCode < 500
+}
+
+// getRun fetches a run and returns its status and parsed data.
+func getRun(runID string) (string, *gabs.Container, *runError) {
 
 	apiURL := "https://" + ScalrHostname + BasePath + "/runs/" + runID
 
@@ -126,28 +507,30 @@ func fetchRunStatus(runID string) (string, *gabs.Container) {
 
 	res, err := doWithRetry(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Request failed: %s\n", err)
-		os.Exit(ExitTransientError)
+		return "", nil, &runError{Err: err}
 	}
 	defer res.Body.Close()
 
 	resBody, err := io.ReadAll(res.Body)
-	checkErr(err)
+	if err != nil {
+		return "", nil, &runError{Err: err}
+	}
 
 	if res.StatusCode >= 300 {
-		showError(resBody, res.StatusCode)
+		return "", nil, &runError{StatusCode: res.StatusCode, Body: resBody}
 	}
 
 	response, err := gabs.ParseJSON(resBody)
-	checkErr(err)
+	if err != nil {
+		return "", nil, &runError{Body: resBody, Err: fmt.Errorf("unexpected response format")}
+	}
 
 	parsed := parseData(response)
 
 	// For single-object responses, parseData returns an array with one item
 	item := parsed.Search("0")
 	if item == nil {
-		fmt.Fprintln(os.Stderr, "Error: Unexpected response format")
-		os.Exit(ExitError)
+		return "", nil, &runError{Body: resBody, Err: fmt.Errorf("unexpected response format")}
 	}
 
 	status := ""
@@ -155,5 +538,24 @@ func fetchRunStatus(runID string) (string, *gabs.Container) {
 		status, _ = item.Path("status").Data().(string)
 	}
 
-	return status, item
+	return status, item, nil
+}
+
+// apiErrorMessage returns the first error message of a JSON:API error response, or the
+// response itself if it has none.
+func apiErrorMessage(body []byte) string {
+	parsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	for _, errObj := range parsed.Path("errors").Children() {
+		for _, field := range []string{"detail", "title"} {
+			if message, ok := errObj.Path(field).Data().(string); ok && message != "" {
+				return message
+			}
+		}
+	}
+
+	return strings.TrimSpace(string(body))
 }
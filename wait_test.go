@@ -0,0 +1,434 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchRun(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vcs-revisions/vcs-3" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		fmt.Fprint(w, `{"data": {"id": "vcs-3", "type": "vcs-revisions", "attributes": {"commit-sha": "CCCCCCC0123456789"}}}`)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	runs := parseData(parseJSONForTest(t, `{
+		"data": [
+			{"id": "run-4", "type": "runs", "attributes": {"created-at": "2024-01-31T12:30:00Z"},
+			 "relationships": {"vcs-revision": {"data": {"type": "vcs-revisions", "id": "vcs-2"}}}},
+			{"id": "run-3", "type": "runs", "attributes": {"created-at": "2024-01-31T12:20:00Z"},
+			 "relationships": {"vcs-revision": {"data": {"type": "vcs-revisions", "id": "vcs-3"}}}},
+			{"id": "run-2", "type": "runs", "attributes": {"created-at": "2024-01-31T12:10:00Z"},
+			 "relationships": {"vcs-revision": {"data": {"type": "vcs-revisions", "id": "vcs-2"}}}},
+			{"id": "run-1", "type": "runs", "attributes": {"created-at": "2024-01-31T11:50:00Z"},
+			 "relationships": {"vcs-revision": {"data": null}}}
+		],
+		"included": [
+			{"id": "vcs-2", "type": "vcs-revisions", "attributes": {"commit-sha": "bbbbbbb0123456789"}}
+		]
+	}`)).Children()
+
+	since := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	revisions := make(map[string]string)
+
+	tests := []struct {
+		name   string
+		after  time.Time
+		commit string
+		want   string
+	}{
+		{"first run since a time", since, "", "run-2"},
+		{"no run since a time", since.Add(time.Hour), "", ""},
+		{"latest run of a commit", time.Time{}, "bbbbbbb", "run-4"},
+		{"commit of a revision that was not included", time.Time{}, "ccccccc", "run-3"},
+		{"unknown commit", time.Time{}, "ddddddd", ""},
+	}
+
+	for _, tt := range tests {
+		if got := matchRun(runs, tt.after, tt.commit, revisions); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRunOutcome(t *testing.T) {
+	manual := parseJSONForTest(t, `{"auto-apply": false}`)
+	auto := parseJSONForTest(t, `{"auto-apply": true}`)
+
+	tests := []struct {
+		status string
+		data   string
+		want   string
+	}{
+		{"applied", "", outcomeSuccess},
+		{"planned_and_finished", "", outcomeSuccess},
+		{"errored", "", outcomeFailed},
+		{"policy_checked", "", outcomeBlocked},
+		{"planned", "manual", outcomeConfirmation},
+		{"planned", "auto", ""},
+		{"applying", "", ""},
+	}
+
+	for _, tt := range tests {
+		data := auto
+		if tt.data == "manual" {
+			data = manual
+		}
+		if got := runOutcome(tt.status, data); got != tt.want {
+			t.Errorf("%s (%s): expected %q, got %q", tt.status, tt.data, tt.want, got)
+		}
+	}
+}
+
+func TestPollRun(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch r.URL.Path {
+		case "/runs/run-1":
+			fmt.Fprint(w, `{"data": {"id": "run-1", "type": "runs", "attributes": {"status": "applied"},
+				"relationships": {"workspace": {"data": {"type": "workspaces", "id": "ws-1"}}}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": [{"status": "404", "title": "not found", "detail": "Run not found"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	events := make(chan runEvent, 3)
+	go pollRun(0, "run-1", time.Now().Add(time.Minute), WaitOptions{}, events)
+	go pollRun(1, "run-2", time.Now().Add(time.Minute), WaitOptions{}, events)
+	go pollRun(2, "run-3", time.Now().Add(-time.Second), WaitOptions{}, events)
+
+	results := make(map[int]*runResult)
+	for len(results) < 3 {
+		event := <-events
+		if event.result != nil {
+			results[event.index] = event.result
+		}
+	}
+
+	if r := results[0]; r.Outcome != outcomeSuccess || r.Status != "applied" || r.Workspace != "ws-1" {
+		t.Errorf("unexpected result for run-1: %+v", r)
+	}
+	if r := results[1]; r.Outcome != outcomeError || r.Message != "HTTP 404: Run not found" {
+		t.Errorf("unexpected result for run-2: %+v", r)
+	}
+	if r := results[2]; r.Outcome != outcomeTimeout {
+		t.Errorf("unexpected result for run-3: %+v", r)
+	}
+
+	if got := splitRunIDs("run-1,run-2\nrun-3 "); len(got) != 3 || got[2] != "run-3" {
+		t.Errorf("unexpected run IDs: %q", got)
+	}
+}
+
+func TestRunLogs(t *testing.T) {
+	planLog := "\x02Terraform will perform the following actions:\n"
+	applyRequests := 0
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plans/plan-1/logs":
+			//Only what was not read yet is sent, like servers that support ranges do
+			var offset int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err != nil {
+				fmt.Fprint(w, planLog)
+			} else if offset >= len(planLog) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			} else {
+				w.WriteHeader(http.StatusPartialContent)
+				fmt.Fprint(w, planLog[offset:])
+			}
+		case "/applies/apply-1/logs":
+			applyRequests++
+			fmt.Fprint(w, "Apply complete!\n\x03")
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	run := parseData(parseJSONForTest(t, `{"data": {"id": "run-1", "type": "runs", "relationships": {
+		"plan": {"data": {"type": "plans", "id": "plan-1"}},
+		"apply": {"data": {"type": "applies", "id": "apply-1"}}
+	}}}`)).Search("0")
+
+	logs := &runLogs{printed: make(map[string]int)}
+
+	var stderr string
+	stderr += captureStderr(t, func() { logs.follow("planning", run) })
+	planLog += "Plan: 1 to add, 0 to change, 0 to destroy.\n"
+	stderr += captureStderr(t, func() { logs.follow("planning", run) })
+
+	if applyRequests != 0 {
+		t.Error("the apply log must not be read while planning")
+	}
+
+	stderr += captureStderr(t, func() { logs.follow("planned", run) })
+	stderr += captureStderr(t, func() { logs.follow("applied", run) })
+	stderr += captureStderr(t, func() { logs.follow("applied", run) })
+
+	want := "Terraform will perform the following actions:\nPlan: 1 to add, 0 to change, 0 to destroy.\nApply complete!\n"
+	if stderr != want {
+		t.Errorf("got\n%q\nwant\n%q", stderr, want)
+	}
+}
+
+func TestRunGate(t *testing.T) {
+	var actions []string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		switch {
+		case r.Method == "POST":
+			body, _ := io.ReadAll(r.Body)
+			actions = append(actions, r.URL.Path+" "+string(body))
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/cost-estimates/ce-1":
+			fmt.Fprint(w, `{"data": {"id": "ce-1", "type": "cost-estimates", "attributes": {"proposed-monthly-cost": "42.50"}}}`)
+		case r.URL.Path == "/policy-checks/pc-1":
+			fmt.Fprint(w, `{"data": {"id": "pc-1", "type": "policy-checks", "attributes": {"status": "passed"}}}`)
+		case r.URL.Path == "/policy-checks/pc-2":
+			fmt.Fprint(w, `{"data": {"id": "pc-2", "type": "policy-checks", "attributes": {"status": "soft_failed"}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	run := parseData(parseJSONForTest(t, `{"data": {"id": "run-1", "type": "runs", "attributes": {"auto-apply": false}, "relationships": {
+		"cost-estimate": {"data": {"type": "cost-estimates", "id": "ce-1"}},
+		"policy-checks": {"data": [{"type": "policy-checks", "id": "pc-1"}, {"type": "policy-checks", "id": "pc-2"}]}
+	}}}`)).Search("0")
+
+	//Without policies, blocked runs end the wait as before
+	if continued, note := newRunGate(WaitOptions{}).handle("run-1", "planned", outcomeConfirmation, run); continued || note != "" {
+		t.Errorf("expected no action without a policy, got %v %q", continued, note)
+	}
+
+	gate := newRunGate(WaitOptions{OnPlanned: "apply", OnPolicySoftFail: "override", ApproveBelow: 50, Comment: "ci"})
+
+	if continued, _ := gate.handle("run-1", "planned", outcomeConfirmation, run); !continued {
+		t.Error("expected the run to be confirmed")
+	}
+	if continued, _ := gate.handle("run-1", "planned", outcomeConfirmation, run); !continued {
+		t.Error("expected to keep polling a run that was confirmed")
+	}
+	if continued, _ := gate.handle("run-1", "policy_checked", outcomeBlocked, run); !continued {
+		t.Error("expected the policy check to be overridden")
+	}
+	if continued, _ := gate.handle("run-1", "cost_estimated", outcomeBlocked, run); !continued {
+		t.Error("expected the cost estimate to be approved")
+	}
+
+	want := []string{
+		`/runs/run-1/actions/apply {"comment":"ci"}`,
+		`/policy-checks/pc-2/actions/override {"data":{"attributes":{"comment":"ci"}}}`,
+		`/runs/run-1/actions/apply {"comment":"ci"}`,
+	}
+	if fmt.Sprint(actions) != fmt.Sprint(want) {
+		t.Errorf("got actions\n%q\nwant\n%q", actions, want)
+	}
+
+	//Costs at or above the limit are not approved
+	expensive := newRunGate(WaitOptions{ApproveBelow: 40, Comment: "ci"})
+	if continued, note := expensive.handle("run-1", "cost_estimated", outcomeBlocked, run); continued || note == "" {
+		t.Errorf("expected the cost estimate not to be approved, got %v %q", continued, note)
+	}
+
+	opts := WaitOptions{OnPlanned: "apply"}
+	if err := validateWaitPolicies(&opts, ""); err == nil {
+		t.Error("expected -comment to be required")
+	}
+	opts = WaitOptions{Comment: "ci"}
+	if err := validateWaitPolicies(&opts, "approve-below=100"); err != nil || opts.ApproveBelow != 100 {
+		t.Errorf("unexpected result %v, %v", err, opts.ApproveBelow)
+	}
+	if err := validateWaitPolicies(&opts, "approve-below=cheap"); err == nil {
+		t.Error("expected an invalid amount to be rejected")
+	}
+}
+
+func TestRunGate_ActionsNotRetried(t *testing.T) {
+	posts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	run := parseData(parseJSONForTest(t, `{"data": {"id": "run-1", "type": "runs"}}`)).Search("0")
+
+	gate := newRunGate(WaitOptions{OnPlanned: "discard", Comment: "ci"})
+	continued, note := gate.handle("run-1", "planned", outcomeConfirmation, run)
+	if continued || !strings.Contains(note, "Could not discard run run-1") {
+		t.Errorf("expected the failed action to be reported, got %v %q", continued, note)
+	}
+	if posts != 1 {
+		t.Errorf("expected the action to be sent once, got %d requests", posts)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	var out strings.Builder
+	stream := &eventStream{out: &out, started: time.Now()}
+
+	stream.status("run-1", "", "planning")
+	stream.status("run-1", "planning", "planning")
+	stream.status("run-1", "planning", "applied")
+	stream.emit(waitEvent{Type: eventDone, Run: "run-1", NewStatus: "applied", Outcome: outcomeSuccess, Data: []byte(`{"id":"run-1"}`)})
+
+	//A stream that was not asked for writes nothing
+	var disabled *eventStream
+	disabled.status("run-1", "", "planning")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 events, got %d:\n%s", len(lines), out.String())
+	}
+
+	want := []string{"transition <nil> planning", "poll planning planning", "transition planning applied", "done <nil> applied"}
+	for i, line := range lines {
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("event %d is not JSON: %s", i, line)
+		}
+
+		got := fmt.Sprintf("%v %v %v", event["type"], event["old-status"], event["new-status"])
+		if got != want[i] {
+			t.Errorf("event %d: expected %q, got %q", i, want[i], got)
+		}
+		if event["run"] != "run-1" || event["timestamp"] == nil || event["elapsed-seconds"] == nil {
+			t.Errorf("event %d is missing fields: %s", i, line)
+		}
+	}
+
+	if !strings.Contains(lines[3], `"outcome":"success"`) || !strings.Contains(lines[3], `"data":{"id":"run-1"}`) {
+		t.Errorf("unexpected done event: %s", lines[3])
+	}
+
+	if err := validateEventsFormat("text"); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	tests := []struct {
+		outcome string
+		status  string
+		want    int
+	}{
+		{outcomeSuccess, "applied", ExitSuccess},
+		{outcomeChanges, "planned_and_finished", ExitPlanChanges},
+		{outcomeFailed, "errored", ExitRunErrored},
+		{outcomeFailed, "discarded", ExitRunCanceled},
+		{outcomeFailed, "force_canceled", ExitRunCanceled},
+		{outcomeBlocked, "policy_checked", ExitRunPolicyBlocked},
+		{outcomeConfirmation, "planned", ExitRunNeedsConfirmation},
+		{outcomeTimeout, "applying", ExitTimeout},
+		{outcomeError, "", ExitError},
+	}
+
+	for _, tt := range tests {
+		if got := runExitCode(tt.outcome, tt.status); got != tt.want {
+			t.Errorf("%s (%s): expected %d, got %d", tt.outcome, tt.status, tt.want, got)
+		}
+	}
+
+	success := runResult{Outcome: outcomeSuccess, Status: "applied"}
+	changes := runResult{Outcome: outcomeChanges, Status: "planned_and_finished"}
+	timeout := runResult{Outcome: outcomeTimeout, Status: "planning"}
+	errored := runResult{Outcome: outcomeFailed, Status: "errored"}
+	canceled := runResult{Outcome: outcomeFailed, Status: "canceled"}
+
+	several := []struct {
+		name    string
+		results []runResult
+		want    int
+	}{
+		{"all succeeded", []runResult{success, success}, ExitSuccess},
+		{"a plan has changes", []runResult{success, changes}, ExitPlanChanges},
+		{"a run timed out", []runResult{changes, timeout}, ExitTimeout},
+		{"a run errored", []runResult{timeout, errored, success}, ExitRunErrored},
+		{"runs ended differently", []runResult{canceled, errored}, ExitRunErrored},
+		{"a run was canceled", []runResult{canceled, timeout}, ExitRunCanceled},
+		{"a run could not be read", []runResult{errored, {Outcome: outcomeError}}, ExitError},
+	}
+
+	for _, tt := range several {
+		if got := runsExitCode(tt.results); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestWithPlanChanges(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plans/plan-2" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": [{"status": "404", "detail": "Plan not found"}]}`)
+			return
+		}
+		if r.URL.Path != "/plans/plan-1" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		fmt.Fprint(w, `{"data": {"id": "plan-1", "type": "plans", "attributes": {"has-changes": true}}}`)
+	}))
+	defer server.Close()
+
+	defer setHost(t, server.URL)()
+	defer withHTTPSClient(t, server)()
+
+	run := parseData(parseJSONForTest(t, `{"data": {"id": "run-1", "type": "runs", "relationships": {
+		"plan": {"data": {"type": "plans", "id": "plan-1"}}
+	}}}`)).Search("0")
+
+	if got, err := withPlanChanges(outcomeSuccess, "planned_and_finished", run); got != outcomeChanges || err != nil {
+		t.Errorf("expected %q, got %q (%v)", outcomeChanges, got, err)
+	}
+	if got, _ := withPlanChanges(outcomeSuccess, "applied", run); got != outcomeSuccess {
+		t.Errorf("applied runs must not be checked for changes, got %q", got)
+	}
+
+	unchanged := parseData(parseJSONForTest(t, `{"data": {"id": "run-2", "type": "runs", "attributes": {"has-changes": false}}}`)).Search("0")
+	if got, _ := withPlanChanges(outcomeSuccess, "planned_and_finished", unchanged); got != outcomeSuccess {
+		t.Errorf("expected %q, got %q", outcomeSuccess, got)
+	}
+
+	//A plan that cannot be read must not pass for one without changes
+	unreadable := parseData(parseJSONForTest(t, `{"data": {"id": "run-3", "type": "runs", "relationships": {
+		"plan": {"data": {"type": "plans", "id": "plan-2"}}
+	}}}`)).Search("0")
+	if got, err := withPlanChanges(outcomeSuccess, "planned_and_finished", unreadable); got != outcomeError || err == nil {
+		t.Errorf("expected %q with an error, got %q (%v)", outcomeError, got, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of events written by -events=ndjson.
+const (
+	eventPoll       = "poll"       // the run was read, its status did not change
+	eventTransition = "transition" // the status of the run changed
+	eventAction     = "action"     // a -on-* policy acted on the run
+	eventDone       = "done"       // waiting for the run is over
+)
+
+// waitEvent is a line of the -events=ndjson stream.
+type waitEvent struct {
+	Type      string          `json:"type"`
+	Run       string          `json:"run"`
+	OldStatus string          `json:"old-status,omitempty"`
+	NewStatus string          `json:"new-status,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Elapsed   float64         `json:"elapsed-seconds"`
+	Outcome   string          `json:"outcome,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"` // the final run, for done events of a single run
+}
+
+// eventStream writes the progress of runs as one JSON object per line, so it can be consumed
+// without reading the human text on stderr. A nil stream writes nothing.
+type eventStream struct {
+	out     io.Writer
+	started time.Time
+	mu      sync.Mutex
+}
+
+// newEventStream returns the stream for the -events flag, nil if it was not given.
+func newEventStream(format string) *eventStream {
+	if format == "" {
+		return nil
+	}
+
+	return &eventStream{out: os.Stdout, started: time.Now()}
+}
+
+// validateEventsFormat checks the value of -events.
+func validateEventsFormat(format string) error {
+	if format != "" && format != "ndjson" {
+		return fmt.Errorf("invalid -events '%s', expected ndjson", format)
+	}
+	return nil
+}
+
+// emit writes an event, with the time it happened and how long the wait has taken so far.
+func (s *eventStream) emit(event waitEvent) {
+	if s == nil {
+		return
+	}
+
+	now := time.Now()
+	event.Timestamp = now.UTC()
+	event.Elapsed = now.Sub(s.started).Round(time.Millisecond).Seconds()
+
+	line, err := json.Marshal(event)
+	checkErr(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(s.out, string(line))
+}
+
+// status writes a transition event if the status changed since the last poll, and a poll
+// event otherwise.
+func (s *eventStream) status(runID string, oldStatus string, newStatus string) {
+	kind := eventTransition
+	if oldStatus == newStatus {
+		kind = eventPoll
+	}
+
+	s.emit(waitEvent{Type: kind, Run: runID, OldStatus: oldStatus, NewStatus: newStatus})
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// runResult is how waiting for one of several runs ended, as printed in the summary.
+type runResult struct {
+	Run       string `json:"run"`
+	Workspace string `json:"workspace,omitempty"`
+	Status    string `json:"status"`
+	Outcome   string `json:"outcome"`
+	Message   string `json:"message,omitempty"`
+}
+
+// runEvent is sent by the poller of a run whenever its status changes, and once it is done.
+type runEvent struct {
+	index  int
+	status string
+	note   string     // an action taken on the run by the -on-* policies
+	result *runResult // set when waiting for the run is over
+}
+
+// readRunIDs reads run IDs from stdin, separated by whitespace or commas, like the output
+// of `scalr -query=.[].id list-runs`. Returns nothing if stdin is not piped.
+func readRunIDs() []string {
+	stat, _ := os.Stdin.Stat()
+	if stat.Mode()&os.ModeNamedPipe == 0 && (stat.Mode()&os.ModeCharDevice != 0 || stat.Size() == 0) {
+		return nil
+	}
+
+	content, err := io.ReadAll(os.Stdin)
+	checkErr(err)
+
+	return splitRunIDs(string(content))
+}
+
+// splitRunIDs splits a list of run IDs separated by commas or whitespace.
+func splitRunIDs(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// waitForRuns polls several runs at once until each of them reached a terminal state or the
+// timeout expired. On a terminal, the status of all runs is shown as a board that is updated
+// in place, otherwise every change is printed on a line of its own. Prints a JSON summary of
+// all runs, or streams events with -events, and exits with success only if all of them
+// succeeded, see runsExitCode.
+func waitForRuns(runIDs []string, opts WaitOptions) {
+	deadline := time.Now().Add(opts.Timeout)
+	events := make(chan runEvent)
+
+	for i, runID := range runIDs {
+		go pollRun(i, runID, deadline, opts, events)
+	}
+
+	stream := newEventStream(opts.Events)
+	board := term.IsTerminal(int(os.Stderr.Fd()))
+	started := time.Now()
+	statuses := make([]string, len(runIDs))
+	results := make([]runResult, len(runIDs))
+	done := 0
+	drawn := 0
+
+	fmt.Fprintf(os.Stderr, "Waiting for %d runs...\n", len(runIDs))
+
+	//Keeps the elapsed time on the board current between changes
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for done < len(runIDs) {
+		if board {
+			drawn = drawRunBoard(runIDs, statuses, results, started, drawn)
+		}
+
+		var event runEvent
+		select {
+		case event = <-events:
+		case <-ticker.C:
+			continue
+		}
+
+		runID := runIDs[event.index]
+
+		//Notes on actions taken go above the board, which is drawn again below them
+		if event.note != "" {
+			if board {
+				clearLines(drawn)
+				drawn = 0
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", runID, event.note)
+		}
+
+		if event.result == nil || event.status != statuses[event.index] {
+			stream.status(runID, statuses[event.index], event.status)
+		}
+		if event.result == nil && event.note != "" {
+			stream.emit(waitEvent{Type: eventAction, Run: runID, NewStatus: event.status, Message: event.note})
+		}
+		if event.result != nil {
+			stream.emit(waitEvent{Type: eventDone, Run: runID, NewStatus: event.status, Outcome: event.result.Outcome, Message: event.result.Message})
+		}
+
+		if event.status != statuses[event.index] {
+			if !board {
+				if statuses[event.index] != "" {
+					fmt.Fprintf(os.Stderr, "%s: %s -> %s\n", runID, statuses[event.index], event.status)
+				} else {
+					fmt.Fprintf(os.Stderr, "%s: Status: %s\n", runID, event.status)
+				}
+			}
+			statuses[event.index] = event.status
+		}
+
+		if event.result != nil {
+			results[event.index] = *event.result
+			done++
+
+			if !board {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", runID, describeResult(*event.result))
+			}
+		}
+	}
+
+	if board {
+		drawRunBoard(runIDs, statuses, results, started, drawn)
+	}
+
+	// The done events already tell how each run ended
+	if stream == nil {
+		summary, err := json.MarshalIndent(results, "", "  ")
+		checkErr(err)
+		fmt.Println(string(summary))
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Outcome == outcomeSuccess || result.Outcome == outcomeChanges {
+			succeeded++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d runs completed successfully\n", succeeded, len(results))
+
+	os.Exit(runsExitCode(results))
+}
+
+// runExitCodeSeverity orders the exit codes of wait-for-run from the least to the most
+// severe. Runs that could not be followed come last, as nothing is known about how they ended.
+var runExitCodeSeverity = []int{
+	ExitSuccess,
+	ExitPlanChanges,
+	ExitTimeout,
+	ExitRunNeedsConfirmation,
+	ExitRunPolicyBlocked,
+	ExitRunCanceled,
+	ExitRunErrored,
+	ExitError,
+}
+
+// runsExitCode returns the exit code for several runs: the most severe code of any of them,
+// in the order of runExitCodeSeverity.
+func runsExitCode(results []runResult) int {
+	code := ExitSuccess
+
+	for _, result := range results {
+		resultCode := runExitCode(result.Outcome, result.Status)
+
+		if slices.Index(runExitCodeSeverity, resultCode) > slices.Index(runExitCodeSeverity, code) {
+			code = resultCode
+		}
+	}
+
+	return code
+}
+
+// pollRun polls a run for waitForRuns, with the same backoff as waitForRun. Failed requests
+// and server errors are retried at the next poll, other errors end waiting for the run.
+func pollRun(index int, runID string, deadline time.Time, opts WaitOptions, events chan<- runEvent) {
+	interval := 2 * time.Second
+	maxInterval := 10 * time.Second
+	lastStatus := ""
+	workspace := ""
+	gate := newRunGate(opts)
+
+	for {
+		if time.Now().After(deadline) {
+			events <- runEvent{index: index, status: lastStatus, result: &runResult{Run: runID, Workspace: workspace, Status: lastStatus, Outcome: outcomeTimeout}}
+			return
+		}
+
+		status, runData, err := getRun(runID)
+
+		if err != nil && err.permanent() {
+			events <- runEvent{index: index, status: lastStatus, result: &runResult{Run: runID, Status: lastStatus, Outcome: outcomeError, Message: err.Error()}}
+			return
+		}
+
+		if err == nil {
+			workspace = relatedID(runData, "workspace")
+
+			outcome := runOutcome(status, runData)
+
+			continued, note := gate.handle(runID, status, outcome, runData)
+			outcome, planErr := withPlanChanges(outcome, status, runData)
+			if planErr != nil {
+				note = planErr.Error()
+			}
+			if continued {
+				outcome = ""
+			}
+
+			if outcome != "" {
+				events <- runEvent{index: index, status: status, note: note, result: &runResult{Run: runID, Workspace: workspace, Status: status, Outcome: outcome, Message: note}}
+				return
+			}
+
+			// Streamed events report every poll
+			if status != lastStatus || note != "" || opts.Events != "" {
+				events <- runEvent{index: index, status: status, note: note}
+				lastStatus = status
+			}
+		}
+
+		time.Sleep(min(interval, time.Until(deadline)+time.Millisecond))
+
+		// Backoff: increase interval up to max
+		interval = min(interval+1*time.Second, maxInterval)
+	}
+}
+
+// describeResult explains how waiting for a run ended.
+func describeResult(result runResult) string {
+	switch result.Outcome {
+	case outcomeSuccess:
+		return fmt.Sprintf("completed successfully (%s)", result.Status)
+	case outcomeChanges:
+		return fmt.Sprintf("completed successfully (%s), the plan has changes", result.Status)
+	case outcomeFailed:
+		return "finished with status: " + result.Status
+	case outcomeBlocked:
+		return fmt.Sprintf("blocked waiting for approval (status: %s)", result.Status)
+	case outcomeConfirmation:
+		return "requires manual confirmation (auto-apply is disabled)"
+	case outcomeTimeout:
+		return "timed out (status: " + result.Status + ")"
+	case outcomeError:
+		//The run finished, its plan could not be read
+		if result.Status == "planned_and_finished" {
+			return fmt.Sprintf("finished (%s), but %s", result.Status, result.Message)
+		}
+		return "could not be read: " + result.Message
+	default:
+		return "could not be read: " + result.Message
+	}
+}
+
+// drawRunBoard redraws the status of every run on stderr, replacing the lines drawn last
+// time. Returns the number of lines drawn.
+func drawRunBoard(runIDs []string, statuses []string, results []runResult, started time.Time, drawn int) int {
+	clearLines(drawn)
+
+	width := 0
+	for _, runID := range runIDs {
+		width = max(width, len(runID))
+	}
+
+	var b strings.Builder
+	done := 0
+
+	for i, runID := range runIDs {
+		line := statuses[i]
+		if line == "" {
+			line = "waiting"
+		}
+		if results[i].Outcome != "" {
+			line = describeResult(results[i])
+			done++
+		}
+
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, runID, line)
+	}
+
+	fmt.Fprintf(&b, "%d of %d done, %s elapsed\n", done, len(runIDs), time.Since(started).Round(time.Second))
+
+	fmt.Fprint(os.Stderr, b.String())
+
+	return len(runIDs) + 1
+}